@@ -0,0 +1,121 @@
+package polywatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pouyanh/polywatch/config"
+)
+
+// runActions takes actions of the watcher in order & stops at the first failure
+func (pw *polyWatcher) runActions(ctx context.Context, cs changeSet) error {
+	for i, a := range pw.cfg.Actions {
+		var (
+			result string
+			err    error
+		)
+
+		switch a.Type {
+		case config.ActionTypeSync:
+			result, err = pw.sync(a, cs)
+
+		case config.ActionTypeHTTP:
+			result, err = pw.request(ctx, a, cs)
+
+		case config.ActionTypeSignalPidFile:
+			result, err = signalPidFile(a)
+
+		default:
+			err = fmt.Errorf("unknown action %q", a.Type)
+		}
+
+		if err != nil {
+			return fmt.Errorf("action #%d (%s) failed: %w", i+1, a.Type, err)
+		}
+
+		pw.lg.Printf("action #%d (%s) succeeded: %s\n", i+1, a.Type, result)
+	}
+
+	return nil
+}
+
+// request sends the request of an http action & checks status of its response
+func (pw *polyWatcher) request(ctx context.Context, a config.Action, cs changeSet) (string, error) {
+	// Already validated on load
+	tpl, _ := config.ParseExec(a.Body)
+	body, err := renderExec(tpl, newExecData(pw.cfg.Name, pw.runs, cs, pw.captures))
+	if err != nil {
+		return "", fmt.Errorf("unable to render body: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, a.Method, os.ExpandEnv(a.URL), strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	for k, v := range a.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Drain a bit of the body, so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if !expectedStatus(a.Status, resp.StatusCode) {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return resp.Status, nil
+}
+
+func expectedStatus(expected []int, status int) bool {
+	if len(expected) == 0 {
+		return status >= 200 && status < 300
+	}
+
+	for _, s := range expected {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// signalPidFile sends signal of the action to the process whose PID is read from its pid file
+func signalPidFile(a config.Action) (string, error) {
+	raw, err := os.ReadFile(os.ExpandEnv(a.PidFile))
+	if err != nil {
+		return "", err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil || pid < 1 {
+		return "", errors.New("pid file doesn't contain a valid pid")
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return "", err
+	}
+
+	if err := p.Signal(a.Signal); err != nil {
+		return "", fmt.Errorf("unable to send signal to pid(%d): %w", pid, err)
+	}
+
+	return fmt.Sprintf("sent sig(%s) to pid(%d)", a.Signal, pid), nil
+}
@@ -0,0 +1,40 @@
+package polywatch
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// runBuild runs build of the command while the previous one keeps running. Output of the build is passed through, so
+// compiler errors are shown as they are
+func (pw *polyWatcher) runBuild(ctx context.Context, cs changeSet) error {
+	// Build belongs to the upcoming run
+	script, err := renderExec(pw.build, newExecData(pw.cfg.Name, pw.runs+1, cs, pw.captures))
+	if err != nil {
+		return fmt.Errorf("unable to render build: %w", err)
+	}
+
+	env, list, err := cs.env(pw.cfg.Name, pw.cfg.Command.ChangedFilesList)
+	if err != nil {
+		pw.lg.Printf("unable to write list of changed files: %s\n", err)
+	}
+	if list != "" {
+		defer os.Remove(list)
+	}
+
+	pw.lg.Println("building...")
+	cmd := pw.command(script)
+	cmd.Env = append(append([]string{}, pw.cfg.Command.Env...), env...)
+	pw.publish(runStarted, false)
+	if err := pw.runJob(ctx, cmd); err != nil {
+		return fmt.Errorf("build failed: %w", err)
+	}
+	if ctx.Err() != nil {
+		// Killed by the watcher which is stopping
+		return fmt.Errorf("build interrupted: %w", ctx.Err())
+	}
+	pw.lg.Println("build succeeded")
+
+	return nil
+}
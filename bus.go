@@ -0,0 +1,169 @@
+package polywatch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pouyanh/polywatch/config"
+)
+
+type runState int
+
+const (
+	runStarted runState = iota
+	runFinished
+)
+
+// runEvent is a lifecycle change of a watcher's run. Success is meaningful only when the run is finished
+type runEvent struct {
+	watcher string
+	state   runState
+	success bool
+}
+
+// bus delivers lifecycle events of watchers to the ones which are chained to them. Subscribers are invoked
+// synchronously, so they have to return quickly
+type bus struct {
+	mu   sync.Mutex
+	subs map[string][]func(e runEvent)
+}
+
+func newBus() *bus {
+	return &bus{
+		subs: make(map[string][]func(e runEvent)),
+	}
+}
+
+func (b *bus) subscribe(watcher string, fn func(e runEvent)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subs[watcher] = append(b.subs[watcher], fn)
+}
+
+func (b *bus) publish(e runEvent) {
+	b.mu.Lock()
+	subs := b.subs[e.watcher]
+	b.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(e)
+	}
+}
+
+func (pw *polyWatcher) publish(state runState, success bool) {
+	if state == runFinished && success {
+		pw.markReady()
+	}
+
+	if pw.bus == nil {
+		return
+	}
+
+	pw.bus.publish(runEvent{
+		watcher: pw.cfg.Name,
+		state:   state,
+		success: success,
+	})
+}
+
+// chain defers events of a watcher while the upstream watcher is running. Once upstream finishes & the watch interval
+// is elapsed, so its outputs are caught too, deferred events get handled as a single batch which restarts the command
+// if the upstream result is the expected one; Otherwise they're dropped
+type chain struct {
+	pw     *polyWatcher
+	ctx    context.Context
+	settle time.Duration
+
+	mu      sync.Mutex
+	running bool
+	timer   *time.Timer
+	trigger bool
+	held    []update
+}
+
+func newChain(ctx context.Context, pw *polyWatcher) *chain {
+	return &chain{
+		pw:     pw,
+		ctx:    ctx,
+		settle: 2 * pw.cfg.Watch.Interval,
+	}
+}
+
+func (c *chain) notify(e runEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+
+	switch e.state {
+	case runStarted:
+		c.running = true
+		// The latest run of upstream decides
+		c.trigger = false
+
+	case runFinished:
+		c.running = false
+		c.trigger = expected(c.pw.cfg.On.Result, e.success)
+		c.timer = time.AfterFunc(c.settle, c.flush)
+	}
+}
+
+func expected(want config.RunResult, success bool) bool {
+	switch want {
+	case config.RunResultAny:
+		return true
+	case config.RunResultFailure:
+		return !success
+	default:
+		return success
+	}
+}
+
+// hold defers uu if upstream is running or has just finished
+func (c *chain) hold(uu ...update) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.running && c.timer == nil {
+		return false
+	}
+
+	c.held = append(c.held, uu...)
+
+	return true
+}
+
+func (c *chain) flush() {
+	c.mu.Lock()
+	uu := c.held
+	trigger := c.trigger
+	c.held, c.trigger, c.timer = nil, false, nil
+	c.mu.Unlock()
+
+	if !trigger {
+		if len(uu) > 0 {
+			c.pw.lg.Printf("dropping %d deferred event(s) due to result of %s\n", len(uu), c.pw.cfg.On.Watcher)
+		}
+
+		return
+	}
+
+	if c.ctx.Err() != nil {
+		return
+	}
+
+	uu = append(uu, update{
+		ctx:   c.ctx,
+		event: triggerEvent(fmt.Sprintf("%s finished", c.pw.cfg.On.Watcher)),
+	})
+
+	if err := c.pw.handleUpdate(uu...); err != nil {
+		c.pw.lg.Printf("error occurred during handling update: %s\n", err)
+	}
+}
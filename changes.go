@@ -0,0 +1,138 @@
+package polywatch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/radovskyb/watcher"
+)
+
+const (
+	EnvChangedFiles     = "POLYWATCH_CHANGED_FILES"
+	EnvChangedFilesList = "POLYWATCH_CHANGED_FILES_LIST"
+	EnvEventOps         = "POLYWATCH_EVENT_OPS"
+	EnvWatcher          = "POLYWATCH_WATCHER"
+	EnvPid              = "POLYWATCH_PID"
+)
+
+// maxEnvValue keeps batch variables far enough from the kernel limit of a single environment string (128KiB), larger
+// batches are just delivered using the list file
+const maxEnvValue = 64 * 1024
+
+// change is the latest operation happened on a path during a batch
+type change struct {
+	Path  string
+	Op    watcher.Op
+	IsDir bool
+	// OldPath is the previous path of renamed or moved files
+	OldPath string
+}
+
+// changeSet is the coalesced batch of events which caused a run
+type changeSet []change
+
+// newChangeSet merges events of the same path keeping the order of their first occurrence. Paths are made relative to
+// the working directory when they're inside it. Synthetic events which aren't bound to any file are omitted
+func newChangeSet(uu []update) changeSet {
+	wd, _ := os.Getwd()
+
+	var cs changeSet
+	index := make(map[string]int)
+	for _, u := range uu {
+		if u.event.Path == "" {
+			continue
+		}
+
+		path := relativePath(wd, u.event.Path)
+
+		var oldPath string
+		if u.event.Op == watcher.Rename || u.event.Op == watcher.Move {
+			oldPath = relativePath(wd, u.event.OldPath)
+		}
+
+		if i, ok := index[path]; ok {
+			cs[i].Op = u.event.Op
+			if oldPath != "" {
+				cs[i].OldPath = oldPath
+			}
+			continue
+		}
+
+		index[path] = len(cs)
+		cs = append(cs, change{
+			Path:    path,
+			Op:      u.event.Op,
+			IsDir:   u.event.FileInfo != nil && u.event.IsDir(),
+			OldPath: oldPath,
+		})
+	}
+
+	return cs
+}
+
+// relativePath makes path relative to wd if it's inside it
+func relativePath(wd, path string) string {
+	if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+
+	return path
+}
+
+func (cs changeSet) paths() []string {
+	pp := make([]string, len(cs))
+	for i, c := range cs {
+		pp[i] = c.Path
+	}
+
+	return pp
+}
+
+func (cs changeSet) ops() []string {
+	oo := make([]string, len(cs))
+	for i, c := range cs {
+		oo[i] = c.Op.String()
+	}
+
+	return oo
+}
+
+// env returns variables describing the batch. Paths & ops are newline-separated & aligned. When the batch is too
+// large or forced by listFile, it's also written into a temporary file which lists an op & a path per line; The
+// caller is responsible for removing the file
+func (cs changeSet) env(name string, listFile bool) (env []string, list string, err error) {
+	files := strings.Join(cs.paths(), "\n")
+	ops := strings.Join(cs.ops(), "\n")
+
+	env = append(env, fmt.Sprintf("%s=%s", EnvWatcher, name))
+	if len(files) > maxEnvValue || len(ops) > maxEnvValue {
+		listFile = true
+	} else {
+		env = append(env,
+			fmt.Sprintf("%s=%s", EnvChangedFiles, files),
+			fmt.Sprintf("%s=%s", EnvEventOps, ops),
+		)
+	}
+
+	if !listFile {
+		return env, "", nil
+	}
+
+	f, err := os.CreateTemp("", "polywatch-changes-*")
+	if err != nil {
+		return env, "", err
+	}
+	defer f.Close()
+
+	for _, c := range cs {
+		if _, err := fmt.Fprintf(f, "%s %s\n", c.Op, c.Path); err != nil {
+			_ = os.Remove(f.Name())
+
+			return env, "", err
+		}
+	}
+
+	return append(env, fmt.Sprintf("%s=%s", EnvChangedFilesList, f.Name())), f.Name(), nil
+}
@@ -16,17 +16,58 @@ const (
 	DefaultWatchMethod   = WatchMethodPolling
 	DefaultWatchInterval = 100 * time.Millisecond
 
-	DefaultWatchFileRecursive bool = true
+	DefaultWatchFileRecursive bool          = true
+	DefaultWatchFileRefresh   time.Duration = 0
 
 	DefaultWatchFilterScope        = WatchFilterScopeFilename
 	DefaultWatchFilterInclude bool = true
 	DefaultWatchFilterType         = WatchFilterTypeRegex
 
+	DefaultWatchSnapshotEnabled bool = false
+	DefaultWatchSnapshotFile         = ".pw.state"
+	DefaultWatchSnapshotHash    bool = false
+
 	DefaultRateLimitStrategy               = RateLimitStrategyNone
 	DefaultRateLimitWait     time.Duration = 0
-
-	DefaultKillSignal                = syscall.SIGTERM
-	DefaultKillTimeout time.Duration = 0
+	DefaultRateLimitLeading  bool          = false
+	DefaultRateLimitTrailing bool          = true
+	DefaultRateLimitMaxWait  time.Duration = 0
+	DefaultRateLimitBurst    int           = 1
+	DefaultRateLimitKey                    = RateLimitKeyNone
+	DefaultRateLimitMaxKeys  int           = 1024
+
+	DefaultCommandRunOnStart            = RunOnStartAlways
+	DefaultCommandIgnoreOwnWrites  bool = false
+	DefaultCommandChangedFilesList bool = false
+	DefaultCommandMode                  = CommandModeService
+	DefaultCommandConcurrency      int  = 0
+	DefaultCommandOnChange              = OnChangeRestart
+	DefaultCommandSignal                = syscall.SIGHUP
+
+	DefaultCommandRestart                         = RestartNever
+	DefaultCommandRestartBackoff    time.Duration = time.Second
+	DefaultCommandRestartMaxBackoff time.Duration = 30 * time.Second
+	DefaultCommandMaxRestarts       int           = 5
+	DefaultCommandRestartWindow     time.Duration = time.Minute
+
+	DefaultRuleRestart bool = false
+
+	DefaultOnResult = RunResultSuccess
+
+	DefaultReadyInterval = 500 * time.Millisecond
+
+	DefaultTriggerFile = ".pw.trigger"
+
+	DefaultActionDelete   bool          = false
+	DefaultActionChecksum bool          = false
+	DefaultActionMethod                 = "POST"
+	DefaultActionTimeout  time.Duration = 10 * time.Second
+	DefaultActionSignal                 = syscall.SIGHUP
+
+	DefaultKillSignal                       = syscall.SIGTERM
+	DefaultKillTimeout        time.Duration = 0
+	DefaultKillCommand                      = ""
+	DefaultKillCommandTimeout time.Duration = 10 * time.Second
 )
 
 var (
@@ -36,25 +77,59 @@ var (
 		RateLimit: DefaultRateLimit,
 		Kill:      DefaultKill,
 		Command:   DefaultCommand,
+		On:        DefaultOn,
+		DependsOn: nil,
+		Ready:     DefaultReady,
+		Triggers:  DefaultTriggers,
+		Actions:   nil,
 	}
 
 	DefaultCommand = Command{
 		Shell: "/bin/sh -c",
 		Path:  ".",
 		Env:   os.Environ(),
+		Build: "",
 		Exec:  "",
+
+		RunOnStart:      DefaultCommandRunOnStart,
+		Outputs:         nil,
+		IgnoreOwnWrites: DefaultCommandIgnoreOwnWrites,
+
+		ChangedFilesList: DefaultCommandChangedFilesList,
+
+		Mode:        DefaultCommandMode,
+		Concurrency: DefaultCommandConcurrency,
+
+		OnChange: DefaultCommandOnChange,
+		Signal:   DefaultCommandSignal,
+
+		Restart:           DefaultCommandRestart,
+		RestartBackoff:    DefaultCommandRestartBackoff,
+		RestartMaxBackoff: DefaultCommandRestartMaxBackoff,
+		MaxRestarts:       DefaultCommandMaxRestarts,
+		RestartWindow:     DefaultCommandRestartWindow,
 	}
 
 	DefaultWatch = Watch{
-		Method:   DefaultWatchMethod,
-		Interval: DefaultWatchInterval,
-		Files:    nil,
-		Filters:  nil,
+		Method:      DefaultWatchMethod,
+		Interval:    DefaultWatchInterval,
+		Files:       nil,
+		Filters:     nil,
+		IgnoreFiles: nil,
+		Snapshot:    DefaultWatchSnapshot,
+	}
+
+	DefaultWatchSnapshot = WatchSnapshot{
+		Enabled: DefaultWatchSnapshotEnabled,
+		File:    DefaultWatchSnapshotFile,
+		Hash:    DefaultWatchSnapshotHash,
 	}
 
 	DefaultWatchFile = WatchFile{
-		Path:      "",
-		Recursive: DefaultWatchFileRecursive,
+		Path:        "",
+		Recursive:   DefaultWatchFileRecursive,
+		FromCommand: "",
+		Refresh:     DefaultWatchFileRefresh,
 	}
 
 	DefaultWatchFilter = WatchFilter{
@@ -67,16 +142,95 @@ var (
 	DefaultRateLimit = RateLimit{
 		Strategy: DefaultRateLimitStrategy,
 		Wait:     DefaultRateLimitWait,
+		Leading:  DefaultRateLimitLeading,
+		Trailing: DefaultRateLimitTrailing,
+		MaxWait:  DefaultRateLimitMaxWait,
+		Burst:    DefaultRateLimitBurst,
+		Key:      DefaultRateLimitKey,
+		MaxKeys:  DefaultRateLimitMaxKeys,
 	}
 
 	DefaultKill = Kill{
-		Signal:  DefaultKillSignal,
-		Timeout: DefaultKillTimeout,
+		Signal:   DefaultKillSignal,
+		Timeout:  DefaultKillTimeout,
+		Sequence: nil,
+
+		Command:        DefaultKillCommand,
+		CommandTimeout: DefaultKillCommandTimeout,
+	}
+
+	DefaultKillStage = KillStage{
+		Signal: nil,
+		Wait:   0,
+	}
+
+	DefaultAction = Action{
+		Type: "",
+
+		Source:      "",
+		Destination: "",
+		Delete:      DefaultActionDelete,
+		Checksum:    DefaultActionChecksum,
+		FileMode:    "",
+		DirMode:     "",
+		Owner:       "",
+
+		URL:     "",
+		Method:  DefaultActionMethod,
+		Headers: nil,
+		Body:    "",
+		Status:  nil,
+		Timeout: DefaultActionTimeout,
+
+		PidFile: "",
+		Signal:  DefaultActionSignal,
+	}
+
+	DefaultWebhook = Webhook{
+		Address: "",
+		Token:   "",
+	}
+
+	DefaultTriggers = Triggers{
+		Schedule: nil,
+	}
+
+	DefaultSchedule = Schedule{
+		Cron:  "",
+		Every: 0,
+	}
+
+	DefaultReady = Ready{
+		Exec:     "",
+		Interval: DefaultReadyInterval,
+	}
+
+	DefaultOn = On{
+		Watcher: "",
+		Result:  DefaultOnResult,
+	}
+
+	DefaultRule = Rule{
+		Name:    "",
+		Files:   nil,
+		Exec:    "",
+		Restart: DefaultRuleRestart,
 	}
 )
 
 type Config struct {
 	Watchers []Watcher `json:"watchers"`
+	Webhook  Webhook   `json:"webhook"`
+	// TriggerFile lists names of watchers, one per line, which get triggered by SIGUSR2
+	TriggerFile string `json:"triggerFile"`
+}
+
+// Webhook is an HTTP listener which triggers watchers on demand. It's disabled when Address is empty
+type Webhook struct {
+	// Address is either a TCP address like 127.0.0.1:8700 or a Unix socket path prefixed by unix:
+	Address string `json:"address"`
+	// Token when set is required as a bearer token of requests
+	Token string `json:"token"`
 }
 
 type Watcher struct {
@@ -85,6 +239,103 @@ type Watcher struct {
 	RateLimit RateLimit `json:"rateLimit"`
 	Kill      Kill      `json:"kill"`
 	Command   Command   `json:"cmd"`
+	// Rules decide what to do with a batch of changes; The first one which matches any of changed files wins
+	Rules []Rule `json:"rules"`
+	On    On     `json:"on"`
+	// DependsOn holds watchers which have to be ready before the first run of this one. Shutdown happens in reverse order
+	DependsOn []string `json:"dependsOn"`
+	Ready     Ready    `json:"ready"`
+	Triggers  Triggers `json:"triggers"`
+	// Actions are steps which are taken in order on each batch of changes before the command runs
+	Actions []Action `json:"actions"`
+}
+
+// Action is a step taken on a batch of changes. Fields are specific to Type
+type Action struct {
+	Type ActionType `json:"action"`
+
+	// Source & Destination are roots of sync; Changed files inside Source are mirrored into Destination
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	// Delete propagates removal of files
+	Delete bool `json:"delete"`
+	// Checksum compares contents of files to skip identical ones, instead of size & modification time
+	Checksum bool `json:"checksum"`
+	// FileMode & DirMode are octal permissions of synced files & directories, e.g. 0644. Empty means preserving them
+	FileMode string `json:"fileMode"`
+	DirMode  string `json:"dirMode"`
+	// Owner is user[:group] of synced files either by name or id. Empty means the owner isn't changed
+	Owner string `json:"owner"`
+
+	// URL, Method, Headers & Body make the request of http action. Body is a template just like command's exec
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	// Status lists expected status codes of the response. Empty means any 2xx
+	Status  []int         `json:"status"`
+	Timeout time.Duration `json:"timeout"`
+
+	// PidFile contains PID of the process which gets Signal
+	PidFile string    `json:"pidFile"`
+	Signal  os.Signal `json:"signal"`
+}
+
+type ActionType string
+
+const (
+	// ActionTypeSync mirrors changed files into another directory
+	ActionTypeSync ActionType = "sync"
+	// ActionTypeHTTP sends an HTTP request, e.g. to a reload endpoint
+	ActionTypeHTTP ActionType = "http"
+	// ActionTypeSignalPidFile sends a signal to a process whose PID is read from a file, e.g. a daemon managed elsewhere
+	ActionTypeSignalPidFile ActionType = "signal-pidfile"
+)
+
+// Triggers fire the watcher besides changes of watched files. They're handled just like file events
+type Triggers struct {
+	Schedule []Schedule `json:"schedule"`
+}
+
+// Schedule fires the watcher either on Cron expression or Every duration
+type Schedule struct {
+	// Cron is a standard cron expression or a descriptor like @hourly, in local time zone
+	Cron  string        `json:"cron"`
+	Every time.Duration `json:"every"`
+}
+
+// Ready decides when dependents of a watcher may start. A watcher is ready once a run finishes successfully or Exec
+// succeeds while the command is running
+type Ready struct {
+	// Exec is a probe which is run using command's shell every Interval after the command is started
+	Exec     string        `json:"exec"`
+	Interval time.Duration `json:"interval"`
+}
+
+// On chains a watcher to runs of another one; The command gets restarted once the upstream run finishes with the
+// expected result, while events of the watcher are deferred during the upstream run
+type On struct {
+	Watcher string    `json:"watcher"`
+	Result  RunResult `json:"result"`
+}
+
+type RunResult string
+
+const (
+	RunResultSuccess RunResult = "success"
+	RunResultFailure RunResult = "failure"
+	RunResultAny     RunResult = "any"
+)
+
+// Rule is an action taken on changes of some of watched files
+type Rule struct {
+	Name string `json:"name"`
+	// Files are gitignore-style patterns of paths relative to the working directory which the rule applies to
+	Files []string `json:"files"`
+	// Exec is run to completion using command's shell & env before the restart. It's a template just like command's exec
+	Exec string `json:"exec"`
+	// Restart restarts the command after Exec succeeds
+	Restart bool `json:"restart"`
 }
 
 type Command struct {
@@ -92,13 +343,86 @@ type Command struct {
 	Exec  string   `json:"exec"`
 	Path  string   `json:"path"`
 	Env   []string `json:"env"`
+	// Build is run before each restart while the previous command keeps running. Failed builds don't restart it
+	Build string `json:"build"`
+
+	RunOnStart RunOnStart `json:"runOnStart"`
+	// Outputs are gitignore-style patterns of files written by the command which get ignored by the watcher
+	Outputs []string `json:"outputs"`
+	// IgnoreOwnWrites ignores events of files which are opened for writing by the command's process tree
+	IgnoreOwnWrites bool `json:"ignoreOwnWrites"`
+	// ChangedFilesList forces writing changed files of each run into a temporary file, which is done anyway when
+	// they're too many to be passed using environment variables
+	ChangedFilesList bool `json:"changedFilesList"`
+
+	Mode CommandMode `json:"mode"`
+	// Concurrency limits number of jobs running at the same time in per-file mode. Zero means number of CPUs
+	Concurrency int `json:"concurrency"`
+
+	OnChange OnChange `json:"onChange"`
+	// Signal is sent to the running command on changes in signal onChange mode
+	Signal os.Signal `json:"signal"`
+
+	// Restart decides whether the command gets restarted when it exits on its own. Delay between restarts starts from
+	// RestartBackoff & gets doubled up to RestartMaxBackoff. Exceeding MaxRestarts within RestartWindow stops restarting
+	// until the next change
+	Restart           RestartPolicy `json:"restart"`
+	RestartBackoff    time.Duration `json:"restartBackoff"`
+	RestartMaxBackoff time.Duration `json:"restartMaxBackoff"`
+	MaxRestarts       int           `json:"maxRestarts"`
+	RestartWindow     time.Duration `json:"restartWindow"`
 }
 
+type CommandMode string
+
+const (
+	// CommandModeService kills the running command & starts it again on each batch of changes
+	CommandModeService CommandMode = "service"
+	// CommandModePerFile runs a job per changed file without killing the running ones
+	CommandModePerFile CommandMode = "per-file"
+)
+
+type OnChange string
+
+const (
+	// OnChangeRestart kills the running command & starts it again
+	OnChangeRestart OnChange = "restart"
+	// OnChangeSignal sends a signal to the running command, e.g. in order to reload, & starts it only if it's not alive
+	OnChangeSignal OnChange = "signal"
+)
+
+type RestartPolicy string
+
+const (
+	RestartNever     RestartPolicy = "never"
+	RestartOnFailure RestartPolicy = "on-failure"
+	RestartAlways    RestartPolicy = "always"
+)
+
+type RunOnStart string
+
+const (
+	RunOnStartAlways RunOnStart = "always"
+	// RunOnStartChanged runs just if watched files have been changed since previous session
+	RunOnStartChanged RunOnStart = "changed"
+	RunOnStartNever   RunOnStart = "never"
+)
+
 type Watch struct {
-	Method   WatchMethod   `json:"method"`
-	Interval time.Duration `json:"interval"`
-	Files    []WatchFile   `json:"files"`
-	Filters  []WatchFilter `json:"filters"`
+	Method      WatchMethod   `json:"method"`
+	Interval    time.Duration `json:"interval"`
+	Files       []WatchFile   `json:"files"`
+	Filters     []WatchFilter `json:"filters"`
+	IgnoreFiles []string      `json:"ignoreFiles"`
+	Snapshot    WatchSnapshot `json:"snapshot"`
+}
+
+// WatchSnapshot persists state of watched files on shutdown, so changes made while not running get detected on startup
+type WatchSnapshot struct {
+	Enabled bool   `json:"enabled"`
+	File    string `json:"file"`
+	// Hash enables comparison of file contents in addition to size & modification time
+	Hash bool `json:"hash"`
 }
 
 type WatchMethod string
@@ -111,6 +435,11 @@ const (
 type WatchFile struct {
 	Path      string `json:"path"`
 	Recursive bool   `json:"recursive"`
+
+	// FromCommand when set is run using command shell & the newline-separated paths it prints get watched instead of Path
+	FromCommand string `json:"fromCommand"`
+	// Refresh is the interval of re-running FromCommand. Zero means just on creation or removal of listed files
+	Refresh time.Duration `json:"refresh"`
 }
 
 type WatchFilter struct {
@@ -137,6 +466,17 @@ const (
 type RateLimit struct {
 	Strategy RateLimitStrategy `json:"strategy"`
 	Wait     time.Duration     `json:"wait"`
+	// Leading, Trailing & MaxWait customize debounce strategy. MaxWait guarantees a run at least once per its
+	// duration while events keep arriving
+	Leading  bool          `json:"leading"`
+	Trailing bool          `json:"trailing"`
+	MaxWait  time.Duration `json:"maxWait"`
+	// Burst is size of the bucket in token-bucket strategy, which gets refilled by a token per Wait
+	Burst int `json:"burst"`
+	// Key separates rate limiting state of events, e.g. each path gets its own debounce timer
+	Key RateLimitKey `json:"key"`
+	// MaxKeys bounds number of keys whose state is kept
+	MaxKeys int `json:"maxKeys"`
 }
 
 type RateLimitStrategy string
@@ -147,11 +487,32 @@ const (
 	RateLimitStrategyThrottle RateLimitStrategy = "throttle"
 	RateLimitStrategyAudit    RateLimitStrategy = "audit"
 	RateLimitStrategySample   RateLimitStrategy = "sample"
+	// RateLimitStrategyTokenBucket allows bursts of runs while holding them to a steady rate in the long run
+	RateLimitStrategyTokenBucket RateLimitStrategy = "token-bucket"
+)
+
+type RateLimitKey string
+
+const (
+	RateLimitKeyNone RateLimitKey = "none"
+	RateLimitKeyPath RateLimitKey = "path"
 )
 
 type Kill struct {
 	Signal  os.Signal     `json:"signal"`
 	Timeout time.Duration `json:"timeout"`
+	// Sequence when set replaces Signal & Timeout by stages which are taken in order until the command exits
+	Sequence []KillStage `json:"sequence"`
+
+	// Command is run using shell of the watcher in order to stop the command before falling back to signals
+	Command        string        `json:"command"`
+	CommandTimeout time.Duration `json:"commandTimeout"`
+}
+
+// KillStage sends Signal & waits for the command to exit. Zero Wait means waiting until it exits
+type KillStage struct {
+	Signal os.Signal     `json:"signal"`
+	Wait   time.Duration `json:"wait"`
 }
 
 type Configurator interface {
@@ -182,6 +543,10 @@ func Load() (*Config, error) {
 			return nil, err
 		}
 
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+
 		cfgCache = cfg
 	}
 
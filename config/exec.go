@@ -0,0 +1,84 @@
+package config
+
+import (
+	"io"
+	"regexp"
+)
+
+// ExecChange describes a changed file in command template
+type ExecChange struct {
+	Path string
+	Dir  string
+	Op   string
+	// Match holds the whole match & capture groups of the filename filter which matched the path
+	Match []string
+	// Groups holds named capture groups of the filename filter which matched the path
+	Groups map[string]string
+}
+
+// ExecData is what command template gets rendered with. Path, Dir, Op, Match & Groups belong to the first change, so
+// single file batches can get accessed easily
+type ExecData struct {
+	Watcher string
+	Run     int
+	Files   []string
+	Ops     []string
+	Changes []ExecChange
+
+	ExecChange
+}
+
+// checkExec renders exec against a sample of the data, so unknown fields & capture groups are reported on load rather
+// than on the first run
+func (w Watcher) checkExec(exec string) error {
+	tpl, err := ParseExec(exec)
+	if err != nil {
+		return err
+	}
+
+	return tpl.Execute(io.Discard, w.sampleExecData())
+}
+
+// sampleExecData returns a single change batch whose match & groups have all capture groups of inclusive filename
+// regex filters of the watcher
+func (w Watcher) sampleExecData() ExecData {
+	change := ExecChange{
+		Path:   "sample",
+		Dir:    ".",
+		Op:     "WRITE",
+		Match:  []string{"sample"},
+		Groups: make(map[string]string),
+	}
+
+	for _, wf := range w.Watch.Filters {
+		if wf.On != WatchFilterScopeFilename || wf.Type != WatchFilterTypeRegex || !wf.Include {
+			continue
+		}
+
+		for _, pattern := range wf.List {
+			r, err := regexp.Compile(pattern)
+			if err != nil {
+				continue
+			}
+
+			for len(change.Match) < r.NumSubexp()+1 {
+				change.Match = append(change.Match, "sample")
+			}
+
+			for _, name := range r.SubexpNames() {
+				if name != "" {
+					change.Groups[name] = "sample"
+				}
+			}
+		}
+	}
+
+	return ExecData{
+		Watcher:    w.Name,
+		Run:        1,
+		Files:      []string{change.Path},
+		Ops:        []string{change.Op},
+		Changes:    []ExecChange{change},
+		ExecChange: change,
+	}
+}
@@ -0,0 +1,411 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid config")
+)
+
+// ExecFuncs are functions available in command templates
+var ExecFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"quote": shellQuote,
+}
+
+// ParseExec parses command's exec as a text/template which gets rendered per run
+func ParseExec(exec string) (*template.Template, error) {
+	return template.New("exec").Funcs(ExecFuncs).Option("missingkey=error").Parse(exec)
+}
+
+// shellQuote quotes s to be used as a single word in POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Validate reports the first problem found in the config
+func (cfg Config) Validate() error {
+	for _, w := range cfg.Watchers {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := cfg.validateChains(); err != nil {
+		return err
+	}
+
+	return cfg.validateDependencies()
+}
+
+func (cfg Config) validateChains() error {
+	names := make(map[string]int)
+	for _, w := range cfg.Watchers {
+		names[w.Name]++
+	}
+
+	byName := make(map[string]Watcher)
+	for _, w := range cfg.Watchers {
+		byName[w.Name] = w
+	}
+
+	edges := make(map[string][]string)
+	for _, w := range cfg.Watchers {
+		if w.On.Watcher == "" {
+			continue
+		}
+
+		switch names[w.On.Watcher] {
+		case 0:
+			return fmt.Errorf("%w: watcher %q: on.watcher: unknown watcher %q", ErrInvalidConfig, w.Name, w.On.Watcher)
+		case 1:
+		default:
+			return fmt.Errorf("%w: watcher %q: on.watcher: ambiguous watcher %q", ErrInvalidConfig, w.Name, w.On.Watcher)
+		}
+
+		if byName[w.On.Watcher].longRunning() {
+			return fmt.Errorf("%w: watcher %q: on.watcher: %q runs a long-running service without ready.exec, so its "+
+				"runs never finish", ErrInvalidConfig, w.Name, w.On.Watcher)
+		}
+
+		edges[w.Name] = append(edges[w.Name], w.On.Watcher)
+	}
+
+	if cycle := findCycle(edges); cycle != nil {
+		return fmt.Errorf("%w: watchers are chained in a cycle: %s", ErrInvalidConfig, strings.Join(cycle, " -> "))
+	}
+
+	return nil
+}
+
+func (cfg Config) validateDependencies() error {
+	names := make(map[string]int)
+	for _, w := range cfg.Watchers {
+		names[w.Name]++
+	}
+
+	byName := make(map[string]Watcher)
+	for _, w := range cfg.Watchers {
+		byName[w.Name] = w
+	}
+
+	edges := make(map[string][]string)
+	for _, w := range cfg.Watchers {
+		for _, dep := range w.DependsOn {
+			switch names[dep] {
+			case 0:
+				return fmt.Errorf("%w: watcher %q: dependsOn: unknown watcher %q", ErrInvalidConfig, w.Name, dep)
+			case 1:
+			default:
+				return fmt.Errorf("%w: watcher %q: dependsOn: ambiguous watcher %q", ErrInvalidConfig, w.Name, dep)
+			}
+
+			if d := byName[dep]; len(d.Watch.Files) == 0 || d.Command.RunOnStart == RunOnStartNever {
+				return fmt.Errorf("%w: watcher %q: dependsOn: %q doesn't run on start, so it never gets ready",
+					ErrInvalidConfig, w.Name, dep)
+			} else if d.longRunning() {
+				return fmt.Errorf("%w: watcher %q: dependsOn: %q runs a long-running service without ready.exec, so it "+
+					"never gets ready", ErrInvalidConfig, w.Name, dep)
+			}
+
+			edges[w.Name] = append(edges[w.Name], dep)
+		}
+	}
+
+	if cycle := findCycle(edges); cycle != nil {
+		return fmt.Errorf("%w: watchers depend on each other in a cycle: %s", ErrInvalidConfig, strings.Join(cycle, " -> "))
+	}
+
+	return nil
+}
+
+// longRunning reports whether the command is meant to keep running, i.e. it's restarted on exit or reloaded by signal,
+// while there's no probe to report when it's up
+func (w Watcher) longRunning() bool {
+	if w.Command.Mode != CommandModeService || w.Command.Exec == "" || w.Ready.Exec != "" {
+		return false
+	}
+
+	return w.Command.Restart != RestartNever || w.Command.OnChange == OnChangeSignal
+}
+
+// findCycle returns the first cycle found in the directed graph, starting & ending by the same node
+func findCycle(edges map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var (
+		state = make(map[string]int)
+		path  []string
+		visit func(n string) []string
+	)
+
+	visit = func(n string) []string {
+		switch state[n] {
+		case visiting:
+			for i, p := range path {
+				if p == n {
+					return append(append([]string{}, path[i:]...), n)
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		state[n] = visiting
+		path = append(path, n)
+		for _, m := range edges[n] {
+			if cycle := visit(m); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[n] = visited
+
+		return nil
+	}
+
+	nodes := make([]string, 0, len(edges))
+	for n := range edges {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+
+	for _, n := range nodes {
+		if cycle := visit(n); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
+
+func (w Watcher) Validate() error {
+	if err := w.checkExec(w.Command.Exec); err != nil {
+		return fmt.Errorf("%w: watcher %q: cmd.exec: %s", ErrInvalidConfig, w.Name, err)
+	}
+
+	switch w.Command.Mode {
+	case CommandModeService, CommandModePerFile:
+	default:
+		return fmt.Errorf("%w: watcher %q: cmd.mode: unknown mode %q", ErrInvalidConfig, w.Name, w.Command.Mode)
+	}
+
+	switch w.RateLimit.Strategy {
+	case RateLimitStrategyNone, RateLimitStrategyDebounce, RateLimitStrategyThrottle, RateLimitStrategyAudit,
+		RateLimitStrategySample, RateLimitStrategyTokenBucket:
+	default:
+		return fmt.Errorf("%w: watcher %q: rateLimit.strategy: unknown strategy %q", ErrInvalidConfig, w.Name,
+			w.RateLimit.Strategy)
+	}
+
+	if w.RateLimit.Strategy == RateLimitStrategyDebounce && !w.RateLimit.Leading && !w.RateLimit.Trailing {
+		return fmt.Errorf("%w: watcher %q: rateLimit: debounce requires leading or trailing", ErrInvalidConfig, w.Name)
+	}
+
+	if w.RateLimit.Strategy == RateLimitStrategyTokenBucket {
+		if w.RateLimit.Burst < 1 {
+			return fmt.Errorf("%w: watcher %q: rateLimit.burst: must be at least 1", ErrInvalidConfig, w.Name)
+		}
+
+		if w.RateLimit.Wait <= 0 {
+			return fmt.Errorf("%w: watcher %q: rateLimit.wait: token-bucket requires a positive refill interval",
+				ErrInvalidConfig, w.Name)
+		}
+	}
+
+	switch w.RateLimit.Key {
+	case RateLimitKeyNone:
+	case RateLimitKeyPath:
+		if w.RateLimit.MaxKeys < 1 {
+			return fmt.Errorf("%w: watcher %q: rateLimit.maxKeys: must be at least 1", ErrInvalidConfig, w.Name)
+		}
+	default:
+		return fmt.Errorf("%w: watcher %q: rateLimit.key: unknown key %q", ErrInvalidConfig, w.Name, w.RateLimit.Key)
+	}
+
+	switch w.Command.RunOnStart {
+	case RunOnStartAlways, RunOnStartNever:
+	case RunOnStartChanged:
+		if !w.Watch.Snapshot.Enabled {
+			return fmt.Errorf("%w: watcher %q: cmd.runOnStart: %q requires watch.snapshot.enabled", ErrInvalidConfig,
+				w.Name, RunOnStartChanged)
+		}
+	default:
+		return fmt.Errorf("%w: watcher %q: cmd.runOnStart: unknown value %q", ErrInvalidConfig, w.Name,
+			w.Command.RunOnStart)
+	}
+
+	switch w.Command.OnChange {
+	case OnChangeRestart:
+	case OnChangeSignal:
+		if w.Command.Mode != CommandModeService {
+			return fmt.Errorf("%w: watcher %q: cmd.onChange: %q is supported just in %q mode", ErrInvalidConfig,
+				w.Name, OnChangeSignal, CommandModeService)
+		}
+	default:
+		return fmt.Errorf("%w: watcher %q: cmd.onChange: unknown value %q", ErrInvalidConfig, w.Name, w.Command.OnChange)
+	}
+
+	switch w.On.Result {
+	case RunResultSuccess, RunResultFailure, RunResultAny:
+	default:
+		return fmt.Errorf("%w: watcher %q: on.result: unknown result %q", ErrInvalidConfig, w.Name, w.On.Result)
+	}
+
+	for i, sch := range w.Triggers.Schedule {
+		if (sch.Cron == "") == (sch.Every == 0) {
+			return fmt.Errorf("%w: watcher %q: triggers.schedule[%d]: either cron or every is required", ErrInvalidConfig, w.Name, i)
+		}
+
+		// Cron runs schedules at a second precision
+		if sch.Every != 0 && (sch.Every < time.Second || sch.Every%time.Second != 0) {
+			return fmt.Errorf("%w: watcher %q: triggers.schedule[%d].every: must be a whole number of seconds",
+				ErrInvalidConfig, w.Name, i)
+		}
+
+		if sch.Cron != "" {
+			if _, err := cron.ParseStandard(sch.Cron); err != nil {
+				return fmt.Errorf("%w: watcher %q: triggers.schedule[%d].cron: %s", ErrInvalidConfig, w.Name, i, err)
+			}
+		}
+	}
+
+	if w.Kill.Command != "" && w.Kill.CommandTimeout <= 0 {
+		return fmt.Errorf("%w: watcher %q: kill.commandTimeout: must be positive", ErrInvalidConfig, w.Name)
+	}
+
+	for i, ks := range w.Kill.Sequence {
+		if ks.Signal == nil {
+			return fmt.Errorf("%w: watcher %q: kill.sequence[%d].signal: unknown signal", ErrInvalidConfig, w.Name, i)
+		}
+
+		if ks.Wait <= 0 && i < len(w.Kill.Sequence)-1 {
+			return fmt.Errorf("%w: watcher %q: kill.sequence[%d].wait: required except for the last stage", ErrInvalidConfig, w.Name, i)
+		}
+	}
+
+	for i, a := range w.Actions {
+		if err := a.Validate(); err != nil {
+			return fmt.Errorf("%w: watcher %q: actions[%d]: %s", ErrInvalidConfig, w.Name, i, err)
+		}
+
+		if a.Type == ActionTypeHTTP {
+			if err := w.checkExec(a.Body); err != nil {
+				return fmt.Errorf("%w: watcher %q: actions[%d]: body: %s", ErrInvalidConfig, w.Name, i, err)
+			}
+		}
+	}
+
+	switch w.Command.Restart {
+	case RestartNever:
+	case RestartOnFailure, RestartAlways:
+		if w.Command.Exec == "" || w.Command.Mode != CommandModeService {
+			return fmt.Errorf("%w: watcher %q: cmd.restart: requires exec in %q mode", ErrInvalidConfig, w.Name,
+				CommandModeService)
+		}
+
+		if w.Command.RestartBackoff <= 0 || w.Command.RestartMaxBackoff < w.Command.RestartBackoff {
+			return fmt.Errorf("%w: watcher %q: cmd.restartBackoff: must be positive & at most restartMaxBackoff",
+				ErrInvalidConfig, w.Name)
+		}
+
+		if w.Command.MaxRestarts < 1 || w.Command.RestartWindow <= 0 {
+			return fmt.Errorf("%w: watcher %q: cmd.maxRestarts & cmd.restartWindow: must be positive", ErrInvalidConfig,
+				w.Name)
+		}
+	default:
+		return fmt.Errorf("%w: watcher %q: cmd.restart: unknown policy %q", ErrInvalidConfig, w.Name, w.Command.Restart)
+	}
+
+	if w.Command.Build != "" {
+		if err := w.checkExec(w.Command.Build); err != nil {
+			return fmt.Errorf("%w: watcher %q: cmd.build: %s", ErrInvalidConfig, w.Name, err)
+		}
+
+		if w.Command.Exec == "" || w.Command.Mode != CommandModeService {
+			return fmt.Errorf("%w: watcher %q: cmd.build: requires exec in %q mode", ErrInvalidConfig, w.Name,
+				CommandModeService)
+		}
+	}
+
+	if w.Command.Exec == "" && w.Command.Mode == CommandModePerFile {
+		return fmt.Errorf("%w: watcher %q: cmd.exec: required in %q mode", ErrInvalidConfig, w.Name, CommandModePerFile)
+	}
+
+	if len(w.Rules) > 0 && w.Command.Mode != CommandModeService {
+		return fmt.Errorf("%w: watcher %q: rules: supported just in %q mode", ErrInvalidConfig, w.Name, CommandModeService)
+	}
+
+	for i, r := range w.Rules {
+		if len(r.Files) == 0 {
+			return fmt.Errorf("%w: watcher %q: rules[%d]: no files", ErrInvalidConfig, w.Name, i)
+		}
+
+		if err := w.checkExec(r.Exec); err != nil {
+			return fmt.Errorf("%w: watcher %q: rules[%d].exec: %s", ErrInvalidConfig, w.Name, i, err)
+		}
+	}
+
+	return nil
+}
+
+func (a Action) Validate() error {
+	switch a.Type {
+	case ActionTypeSync:
+		if a.Source == "" || a.Destination == "" {
+			return errors.New("source & destination are required")
+		}
+
+		for _, mode := range []string{a.FileMode, a.DirMode} {
+			if _, err := ParseMode(mode); err != nil {
+				return err
+			}
+		}
+
+	case ActionTypeHTTP:
+		if a.URL == "" {
+			return errors.New("url is required")
+		}
+
+		if _, err := ParseExec(a.Body); err != nil {
+			return fmt.Errorf("body: %s", err)
+		}
+
+	case ActionTypeSignalPidFile:
+		if a.PidFile == "" {
+			return errors.New("pidFile is required")
+		}
+
+	default:
+		return fmt.Errorf("unknown action %q", a.Type)
+	}
+
+	return nil
+}
+
+// ParseMode parses octal permissions like 0644. Zero is returned for an empty mode
+func ParseMode(mode string) (uint32, error) {
+	if mode == "" {
+		return 0, nil
+	}
+
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0o7777 {
+		return 0, fmt.Errorf("invalid mode %q", mode)
+	}
+
+	return uint32(m), nil
+}
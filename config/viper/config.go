@@ -45,6 +45,9 @@ func (cfr configurator) Load() (*config.Config, error) {
 
 type Config struct {
 	Watchers []Watcher `mapstructure:"watchers"`
+	Webhook  Webhook   `mapstructure:"webhook"`
+
+	TriggerFile string `mapstructure:"triggerFile"`
 }
 
 func (cfg Config) decode() config.Config {
@@ -52,6 +55,21 @@ func (cfg Config) decode() config.Config {
 	for _, w := range cfg.Watchers {
 		dst.Watchers = append(dst.Watchers, w.decode())
 	}
+	dst.Webhook = cfg.Webhook.decode()
+	dst.TriggerFile = override(cfg.TriggerFile, config.DefaultTriggerFile, testStringZero)
+
+	return dst
+}
+
+type Webhook struct {
+	Address string `mapstructure:"address"`
+	Token   string `mapstructure:"token"`
+}
+
+func (wh Webhook) decode() config.Webhook {
+	dst := config.DefaultWebhook
+	dst.Address = override(wh.Address, dst.Address, testStringZero)
+	dst.Token = override(wh.Token, dst.Token, testStringZero)
 
 	return dst
 }
@@ -62,6 +80,12 @@ type Watcher struct {
 	RateLimit RateLimit `mapstructure:"rateLimit"`
 	Kill      Kill      `mapstructure:"kill"`
 	Command   Command   `mapstructure:"cmd"`
+	Rules     []Rule    `mapstructure:"rules"`
+	On        On        `mapstructure:"on"`
+	DependsOn []string  `mapstructure:"dependsOn"`
+	Ready     Ready     `mapstructure:"ready"`
+	Triggers  Triggers  `mapstructure:"triggers"`
+	Actions   []Action  `mapstructure:"actions"`
 }
 
 func (w Watcher) decode() config.Watcher {
@@ -71,15 +95,140 @@ func (w Watcher) decode() config.Watcher {
 	dst.RateLimit = w.RateLimit.decode()
 	dst.Kill = w.Kill.decode()
 	dst.Command = w.Command.decode()
+	for _, r := range w.Rules {
+		dst.Rules = append(dst.Rules, r.decode())
+	}
+	dst.On = w.On.decode()
+	dst.DependsOn = override(w.DependsOn, dst.DependsOn, testStringSliceZero)
+	dst.Ready = w.Ready.decode()
+	dst.Triggers = w.Triggers.decode()
+	for _, a := range w.Actions {
+		dst.Actions = append(dst.Actions, a.decode())
+	}
+
+	return dst
+}
+
+type Action struct {
+	Type config.ActionType `mapstructure:"action"`
+
+	Source      string `mapstructure:"source"`
+	Destination string `mapstructure:"destination"`
+	Delete      *bool  `mapstructure:"delete"`
+	Checksum    *bool  `mapstructure:"checksum"`
+	FileMode    string `mapstructure:"fileMode"`
+	DirMode     string `mapstructure:"dirMode"`
+	Owner       string `mapstructure:"owner"`
+
+	URL     string            `mapstructure:"url"`
+	Method  string            `mapstructure:"method"`
+	Headers map[string]string `mapstructure:"headers"`
+	Body    string            `mapstructure:"body"`
+	Status  []int             `mapstructure:"status"`
+	Timeout *time.Duration    `mapstructure:"timeout"`
+
+	PidFile string `mapstructure:"pidFile"`
+	Signal  string `mapstructure:"signal"`
+}
+
+func (a Action) decode() config.Action {
+	dst := config.DefaultAction
+	dst.Type = config.ActionType(override(string(a.Type), string(dst.Type), testStringZero))
+	dst.Source = override(a.Source, dst.Source, testStringZero)
+	dst.Destination = override(a.Destination, dst.Destination, testStringZero)
+	dst.Delete = *override(a.Delete, &dst.Delete, testNil[bool])
+	dst.Checksum = *override(a.Checksum, &dst.Checksum, testNil[bool])
+	dst.FileMode = override(a.FileMode, dst.FileMode, testStringZero)
+	dst.DirMode = override(a.DirMode, dst.DirMode, testStringZero)
+	dst.Owner = override(a.Owner, dst.Owner, testStringZero)
+	dst.URL = override(a.URL, dst.URL, testStringZero)
+	dst.Method = strings.ToUpper(override(a.Method, dst.Method, testStringZero))
+	dst.Headers = a.Headers
+	dst.Body = override(a.Body, dst.Body, testStringZero)
+	dst.Status = a.Status
+	dst.Timeout = *override(a.Timeout, &dst.Timeout, testNil[time.Duration])
+	dst.PidFile = override(a.PidFile, dst.PidFile, testStringZero)
+	dst.Signal = syscall.Signal(override(int(signalFromName(a.Signal)), int(dst.Signal.(syscall.Signal)), testIntZero))
+
+	return dst
+}
+
+type Triggers struct {
+	Schedule []Schedule `mapstructure:"schedule"`
+}
+
+func (t Triggers) decode() config.Triggers {
+	dst := config.DefaultTriggers
+	for _, s := range t.Schedule {
+		dst.Schedule = append(dst.Schedule, s.decode())
+	}
+
+	return dst
+}
+
+type Schedule struct {
+	Cron  string         `mapstructure:"cron"`
+	Every *time.Duration `mapstructure:"every"`
+}
+
+func (s Schedule) decode() config.Schedule {
+	dst := config.DefaultSchedule
+	dst.Cron = override(s.Cron, dst.Cron, testStringZero)
+	dst.Every = *override(s.Every, &dst.Every, testNil[time.Duration])
+
+	return dst
+}
+
+type Ready struct {
+	Exec     string         `mapstructure:"exec"`
+	Interval *time.Duration `mapstructure:"interval"`
+}
+
+func (r Ready) decode() config.Ready {
+	dst := config.DefaultReady
+	dst.Exec = override(r.Exec, dst.Exec, testStringZero)
+	dst.Interval = *override(r.Interval, &dst.Interval, testNil[time.Duration])
+
+	return dst
+}
+
+type On struct {
+	Watcher string           `mapstructure:"watcher"`
+	Result  config.RunResult `mapstructure:"result"`
+}
+
+func (o On) decode() config.On {
+	dst := config.DefaultOn
+	dst.Watcher = override(o.Watcher, dst.Watcher, testStringZero)
+	dst.Result = config.RunResult(override(string(o.Result), string(dst.Result), testStringZero))
+
+	return dst
+}
+
+type Rule struct {
+	Name    string   `mapstructure:"name"`
+	Files   []string `mapstructure:"files"`
+	Exec    string   `mapstructure:"exec"`
+	Restart *bool    `mapstructure:"restart"`
+}
+
+func (r Rule) decode() config.Rule {
+	dst := config.DefaultRule
+	dst.Name = override(r.Name, dst.Name, testStringZero)
+	dst.Files = override(r.Files, dst.Files, testStringSliceZero)
+	dst.Exec = override(r.Exec, dst.Exec, testStringZero)
+	dst.Restart = *override(r.Restart, &dst.Restart, testNil[bool])
 
 	return dst
 }
 
 type Watch struct {
-	Method   config.WatchMethod `mapstructure:"method"`
-	Interval *time.Duration     `mapstructure:"interval"`
-	Files    []WatchFile        `mapstructure:"files"`
-	Filters  []WatchFilter      `mapstructure:"filters"`
+	Method      config.WatchMethod `mapstructure:"method"`
+	Interval    *time.Duration     `mapstructure:"interval"`
+	Files       []WatchFile        `mapstructure:"files"`
+	Filters     []WatchFilter      `mapstructure:"filters"`
+	IgnoreFiles []string           `mapstructure:"ignoreFiles"`
+	Snapshot    WatchSnapshot      `mapstructure:"snapshot"`
 }
 
 func (w Watch) decode() config.Watch {
@@ -92,19 +241,40 @@ func (w Watch) decode() config.Watch {
 	for _, f := range w.Filters {
 		dst.Filters = append(dst.Filters, f.decode())
 	}
+	dst.IgnoreFiles = override(w.IgnoreFiles, dst.IgnoreFiles, testStringSliceZero)
+	dst.Snapshot = w.Snapshot.decode()
+
+	return dst
+}
+
+type WatchSnapshot struct {
+	Enabled *bool  `mapstructure:"enabled"`
+	File    string `mapstructure:"file"`
+	Hash    *bool  `mapstructure:"hash"`
+}
+
+func (ws WatchSnapshot) decode() config.WatchSnapshot {
+	dst := config.DefaultWatchSnapshot
+	dst.Enabled = *override(ws.Enabled, &dst.Enabled, testNil[bool])
+	dst.File = override(ws.File, dst.File, testStringZero)
+	dst.Hash = *override(ws.Hash, &dst.Hash, testNil[bool])
 
 	return dst
 }
 
 type WatchFile struct {
-	Path      string `mapstructure:"path"`
-	Recursive *bool  `mapstructure:"recursive"`
+	Path        string         `mapstructure:"path"`
+	Recursive   *bool          `mapstructure:"recursive"`
+	FromCommand string         `mapstructure:"fromCommand"`
+	Refresh     *time.Duration `mapstructure:"refresh"`
 }
 
 func (wf WatchFile) decode() config.WatchFile {
 	dst := config.DefaultWatchFile
 	dst.Path = override(wf.Path, dst.Path, testStringZero)
 	dst.Recursive = *override(wf.Recursive, &dst.Recursive, testNil[bool])
+	dst.FromCommand = override(wf.FromCommand, dst.FromCommand, testStringZero)
+	dst.Refresh = *override(wf.Refresh, &dst.Refresh, testNil[time.Duration])
 
 	return dst
 }
@@ -129,25 +299,61 @@ func (wf WatchFilter) decode() config.WatchFilter {
 type RateLimit struct {
 	Strategy config.RateLimitStrategy `mapstructure:"strategy"`
 	Wait     *time.Duration           `mapstructure:"wait"`
+	Leading  *bool                    `mapstructure:"leading"`
+	Trailing *bool                    `mapstructure:"trailing"`
+	MaxWait  *time.Duration           `mapstructure:"maxWait"`
+	Burst    int                      `mapstructure:"burst"`
+	Key      config.RateLimitKey      `mapstructure:"key"`
+	MaxKeys  int                      `mapstructure:"maxKeys"`
 }
 
 func (rl RateLimit) decode() config.RateLimit {
 	dst := config.DefaultRateLimit
 	dst.Strategy = config.RateLimitStrategy(override(string(rl.Strategy), string(dst.Strategy), testStringZero))
 	dst.Wait = *override(rl.Wait, &dst.Wait, testNil[time.Duration])
+	dst.Leading = *override(rl.Leading, &dst.Leading, testNil[bool])
+	dst.Trailing = *override(rl.Trailing, &dst.Trailing, testNil[bool])
+	dst.MaxWait = *override(rl.MaxWait, &dst.MaxWait, testNil[time.Duration])
+	dst.Burst = override(rl.Burst, dst.Burst, testIntZero)
+	dst.Key = config.RateLimitKey(override(string(rl.Key), string(dst.Key), testStringZero))
+	dst.MaxKeys = override(rl.MaxKeys, dst.MaxKeys, testIntZero)
 
 	return dst
 }
 
 type Kill struct {
-	Signal  string         `mapstructure:"signal"`
-	Timeout *time.Duration `mapstructure:"timeout"`
+	Signal   string         `mapstructure:"signal"`
+	Timeout  *time.Duration `mapstructure:"timeout"`
+	Sequence []KillStage    `mapstructure:"sequence"`
+
+	Command        string         `mapstructure:"command"`
+	CommandTimeout *time.Duration `mapstructure:"commandTimeout"`
 }
 
 func (k Kill) decode() config.Kill {
 	dst := config.DefaultKill
 	dst.Signal = syscall.Signal(override(int(signalFromName(k.Signal)), int(dst.Signal.(syscall.Signal)), testIntZero))
 	dst.Timeout = *override(k.Timeout, &dst.Timeout, testNil[time.Duration])
+	for _, ks := range k.Sequence {
+		dst.Sequence = append(dst.Sequence, ks.decode())
+	}
+	dst.Command = override(k.Command, dst.Command, testStringZero)
+	dst.CommandTimeout = *override(k.CommandTimeout, &dst.CommandTimeout, testNil[time.Duration])
+
+	return dst
+}
+
+type KillStage struct {
+	Signal string         `mapstructure:"signal"`
+	Wait   *time.Duration `mapstructure:"wait"`
+}
+
+func (ks KillStage) decode() config.KillStage {
+	dst := config.DefaultKillStage
+	if sig := signalFromName(ks.Signal); sig != 0 {
+		dst.Signal = sig
+	}
+	dst.Wait = *override(ks.Wait, &dst.Wait, testNil[time.Duration])
 
 	return dst
 }
@@ -157,14 +363,49 @@ type Command struct {
 	Env   []string `mapstructure:"env"`
 	Exec  string   `mapstructure:"exec"`
 	Path  string   `mapstructure:"path"`
+	// Run is an alias of Exec
+	Run   string `mapstructure:"run"`
+	Build string `mapstructure:"build"`
+
+	RunOnStart      config.RunOnStart `mapstructure:"runOnStart"`
+	Outputs         []string          `mapstructure:"outputs"`
+	IgnoreOwnWrites *bool             `mapstructure:"ignoreOwnWrites"`
+
+	ChangedFilesList *bool `mapstructure:"changedFilesList"`
+
+	Mode        config.CommandMode `mapstructure:"mode"`
+	Concurrency int                `mapstructure:"concurrency"`
+
+	OnChange config.OnChange `mapstructure:"onChange"`
+	Signal   string          `mapstructure:"signal"`
+
+	Restart           config.RestartPolicy `mapstructure:"restart"`
+	RestartBackoff    *time.Duration       `mapstructure:"restartBackoff"`
+	RestartMaxBackoff *time.Duration       `mapstructure:"restartMaxBackoff"`
+	MaxRestarts       int                  `mapstructure:"maxRestarts"`
+	RestartWindow     *time.Duration       `mapstructure:"restartWindow"`
 }
 
 func (c Command) decode() config.Command {
 	dst := config.DefaultCommand
 	dst.Shell = override(c.Shell, dst.Shell, testStringZero)
 	dst.Env = append(dst.Env, c.Env...)
-	dst.Exec = override(c.Exec, dst.Exec, testStringZero)
+	dst.Exec = override(c.Exec, override(c.Run, dst.Exec, testStringZero), testStringZero)
+	dst.Build = override(c.Build, dst.Build, testStringZero)
 	dst.Path = override(c.Path, dst.Path, testStringZero)
+	dst.RunOnStart = config.RunOnStart(override(string(c.RunOnStart), string(dst.RunOnStart), testStringZero))
+	dst.Outputs = override(c.Outputs, dst.Outputs, testStringSliceZero)
+	dst.IgnoreOwnWrites = *override(c.IgnoreOwnWrites, &dst.IgnoreOwnWrites, testNil[bool])
+	dst.ChangedFilesList = *override(c.ChangedFilesList, &dst.ChangedFilesList, testNil[bool])
+	dst.Mode = config.CommandMode(override(string(c.Mode), string(dst.Mode), testStringZero))
+	dst.Concurrency = override(c.Concurrency, dst.Concurrency, testIntZero)
+	dst.OnChange = config.OnChange(override(string(c.OnChange), string(dst.OnChange), testStringZero))
+	dst.Signal = syscall.Signal(override(int(signalFromName(c.Signal)), int(dst.Signal.(syscall.Signal)), testIntZero))
+	dst.Restart = config.RestartPolicy(override(string(c.Restart), string(dst.Restart), testStringZero))
+	dst.RestartBackoff = *override(c.RestartBackoff, &dst.RestartBackoff, testNil[time.Duration])
+	dst.RestartMaxBackoff = *override(c.RestartMaxBackoff, &dst.RestartMaxBackoff, testNil[time.Duration])
+	dst.MaxRestarts = override(c.MaxRestarts, dst.MaxRestarts, testIntZero)
+	dst.RestartWindow = *override(c.RestartWindow, &dst.RestartWindow, testNil[time.Duration])
 
 	return dst
 }
@@ -181,7 +422,6 @@ func testStringZero(v string) bool {
 	return len(strings.TrimSpace(v)) == 0
 }
 
-//nolint:unused
 func testStringSliceZero(v []string) bool {
 	return len(v) == 0
 }
@@ -0,0 +1,78 @@
+package polywatch
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+func (pw *polyWatcher) markReady() {
+	pw.readyOnce.Do(func() {
+		pw.lg.Println("ready")
+		close(pw.ready)
+	})
+}
+
+// probe runs the readiness probe periodically while p is running, until it passes. Passing the probe finishes the run
+// successfully, so the watcher gets ready & chained watchers don't wait for p to exit
+func (pw *polyWatcher) probe(ctx context.Context, p *process) {
+	if pw.cfg.Ready.Exec == "" {
+		return
+	}
+
+	go func() {
+		t := time.NewTicker(pw.cfg.Ready.Interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+			case <-p.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+
+			cmd := shellCommand(pw.cfg.Command.Shell, os.ExpandEnv(pw.cfg.Ready.Exec))
+			cmd.Env = pw.cfg.Command.Env
+			if err := pw.runJob(ctx, cmd); err == nil && !p.killed.Load() {
+				pw.finish(p, true)
+				return
+			}
+		}
+	}()
+}
+
+// awaitDependencies blocks until all of dependencies are ready & reports whether it's done before ctx is done
+func (pw *polyWatcher) awaitDependencies(ctx context.Context) bool {
+	for _, dep := range pw.deps {
+		select {
+		case <-dep.ready:
+			continue
+		default:
+		}
+
+		pw.lg.Printf("waiting for %s to get ready...\n", dep.cfg.Name)
+		select {
+		case <-dep.ready:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	return true
+}
+
+// awaitDependents blocks until all of dependents are stopped
+func (pw *polyWatcher) awaitDependents() {
+	for _, d := range pw.dependents {
+		select {
+		case <-d.stopped:
+			continue
+		default:
+		}
+
+		pw.lg.Printf("waiting for %s to stop...\n", d.cfg.Name)
+		<-d.stopped
+	}
+}
@@ -0,0 +1,32 @@
+package polywatch
+
+import (
+	"os"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+// fileInfo describes files which aren't available on disk anymore, like the ones removed while not watching
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	dir     bool
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.dir }
+func (fi fileInfo) Sys() any           { return nil }
+
+// triggerEvent creates a synthetic event which isn't bound to any file
+func triggerEvent(reason string) watcher.Event {
+	return watcher.Event{
+		Op:       watcher.Write,
+		FileInfo: fileInfo{name: reason, modTime: time.Now()},
+	}
+}
@@ -2,6 +2,7 @@ package polywatch
 
 import (
 	"os"
+	"path/filepath"
 	"regexp"
 
 	"github.com/radovskyb/watcher"
@@ -57,3 +58,19 @@ func includeInFileFilter(include bool) (yes error, no error) {
 
 	return
 }
+
+// fileFilterPaths skips files of the given absolute paths
+func fileFilterPaths(paths ...string) watcher.FilterFileHookFunc {
+	skipped := make(map[string]bool)
+	for _, path := range paths {
+		skipped[path] = true
+	}
+
+	return func(_ os.FileInfo, fullPath string) error {
+		if path, err := filepath.Abs(fullPath); err == nil && skipped[path] {
+			return watcher.ErrSkip
+		}
+
+		return nil
+	}
+}
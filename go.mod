@@ -4,6 +4,7 @@ go 1.20
 
 require (
 	github.com/radovskyb/watcher v1.0.7
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/spf13/viper v1.16.0
 	github.com/zmwangx/debounce v1.0.0
 )
@@ -0,0 +1,333 @@
+package polywatch
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+// projectIgnoreFile is honored in the working directory regardless of watch.ignoreFiles & takes precedence over
+// every other ignore file
+const projectIgnoreFile = ".pwignore"
+
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreList holds patterns of a single ignore file. Patterns are relative to base directory
+type ignoreList struct {
+	base     string
+	patterns []ignorePattern
+}
+
+func parseIgnoreList(base string, r io.Reader) ignoreList {
+	il := ignoreList{base: base}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if p, ok := parseIgnorePattern(s.Text()); ok {
+			il.patterns = append(il.patterns, p)
+		}
+	}
+
+	return il
+}
+
+// match reports whether any pattern matched rel (slash separated path relative to base) & if so whether it's ignored.
+// Last matching pattern wins
+func (il ignoreList) match(rel string, isDir bool) (matched, ignored bool) {
+	for i := len(il.patterns) - 1; i >= 0; i-- {
+		p := il.patterns[i]
+		if p.dirOnly && !isDir {
+			continue
+		}
+
+		if p.re.MatchString(rel) {
+			return true, !p.negate
+		}
+	}
+
+	return false, false
+}
+
+// parseIgnorePattern converts a single gitignore line into a pattern. See gitignore(5)
+func parseIgnorePattern(line string) (ignorePattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimIgnoreTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	p := ignorePattern{}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") && !strings.HasSuffix(line, `\/`) {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	// A slash at the beginning or middle anchors the pattern to the directory of the ignore file
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !anchored {
+		sb.WriteString("(?:.*/)?")
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '*' && strings.HasPrefix(line[i:], "**"):
+			before := i == 0 || line[i-1] == '/'
+			after := i+2 == len(line) || line[i+2] == '/'
+			if !before || !after {
+				// Not a standalone "**" component; behaves like a regular star
+				sb.WriteString("[^/]*")
+				i++
+				continue
+			}
+
+			switch {
+			case i+2 == len(line):
+				// Trailing "/**" matches everything inside
+				sb.WriteString(".*")
+			default:
+				// Leading "**/" or middle "/**/" matches zero or more directories
+				sb.WriteString("(?:.*/)?")
+				i++
+			}
+			i++
+
+		case c == '*':
+			sb.WriteString("[^/]*")
+
+		case c == '?':
+			sb.WriteString("[^/]")
+
+		case c == '[':
+			end := strings.IndexByte(line[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+
+			class := line[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+
+		case c == '\\' && i+1 < len(line):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(line[i])))
+
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return ignorePattern{}, false
+	}
+	p.re = re
+
+	return p, true
+}
+
+func trimIgnoreTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+
+	return line
+}
+
+type cachedIgnoreList struct {
+	modTime time.Time
+	size    int64
+	list    *ignoreList
+}
+
+// ignoreMatcher decides about paths using nested ignore files having gitignore semantics
+type ignoreMatcher struct {
+	project string
+	names   []string
+
+	// outputs contains patterns of files written by the command, which are decided after all of ignore files
+	outputs *ignoreList
+
+	mu    sync.Mutex
+	cache map[string]*cachedIgnoreList
+	// nonRecursive contains directories which are listed without descending into their subdirectories. Skipping
+	// their children has to be done using ErrSkip since the watcher doesn't accept SkipDir while listing them
+	nonRecursive map[string]bool
+}
+
+func newIgnoreMatcher(project string, names []string, outputs []string) *ignoreMatcher {
+	var ol *ignoreList
+	if len(outputs) > 0 {
+		il := parseIgnoreList(project, strings.NewReader(strings.Join(outputs, "\n")))
+		ol = &il
+	}
+
+	return &ignoreMatcher{
+		project: project,
+		names:   names,
+		outputs: ol,
+
+		nonRecursive: make(map[string]bool),
+		cache:        make(map[string]*cachedIgnoreList),
+	}
+}
+
+// ignored reports whether path has been excluded by any of ignore files.
+// Ignore files of a directory are consulted before its subdirectories' ones, so the deeper ones take precedence
+func (im *ignoreMatcher) ignored(path string, isDir bool) bool {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	if isDir {
+		// A directory gets visited before its children, so it's the right moment to catch up with its ignore files
+		for _, name := range im.names {
+			im.reload(filepath.Join(path, name))
+		}
+
+		if path == im.project {
+			im.reload(filepath.Join(path, projectIgnoreFile))
+		}
+	}
+
+	ignored := false
+	decide := func(il *ignoreList) {
+		if il == nil {
+			return
+		}
+
+		rel, err := filepath.Rel(il.base, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return
+		}
+
+		if matched, yes := il.match(filepath.ToSlash(rel), isDir); matched {
+			ignored = yes
+		}
+	}
+
+	for _, dir := range im.ancestors(path) {
+		for _, name := range im.names {
+			decide(im.lookup(filepath.Join(dir, name)))
+		}
+	}
+	decide(im.lookup(filepath.Join(im.project, projectIgnoreFile)))
+	decide(im.outputs)
+
+	return ignored
+}
+
+// ancestors returns directories which may contain ignore files affecting path, from the outermost one
+func (im *ignoreMatcher) ancestors(path string) []string {
+	var dd []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dd = append(dd, dir)
+
+		if dir == im.project || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	for i, j := 0, len(dd)-1; i < j; i, j = i+1, j-1 {
+		dd[i], dd[j] = dd[j], dd[i]
+	}
+
+	return dd
+}
+
+func (im *ignoreMatcher) lookup(file string) *ignoreList {
+	if c, ok := im.cache[file]; ok {
+		return c.list
+	}
+
+	return im.reload(file)
+}
+
+func (im *ignoreMatcher) reload(file string) *ignoreList {
+	stat, err := os.Stat(file)
+	if err != nil || stat.IsDir() {
+		im.cache[file] = &cachedIgnoreList{}
+
+		return nil
+	}
+
+	if c, ok := im.cache[file]; ok && c.list != nil && c.modTime.Equal(stat.ModTime()) && c.size == stat.Size() {
+		return c.list
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		im.cache[file] = &cachedIgnoreList{}
+
+		return nil
+	}
+	defer f.Close()
+
+	il := parseIgnoreList(filepath.Dir(file), f)
+	im.cache[file] = &cachedIgnoreList{
+		modTime: stat.ModTime(),
+		size:    stat.Size(),
+		list:    &il,
+	}
+
+	return &il
+}
+
+// hook prunes ignored directories during recursive walks & skips ignored files
+func (im *ignoreMatcher) hook() watcher.FilterFileHookFunc {
+	return func(info os.FileInfo, fullPath string) error {
+		if !im.ignored(fullPath, info.IsDir()) {
+			return nil
+		}
+
+		if info.IsDir() && !im.isNonRecursive(filepath.Dir(fullPath)) {
+			return filepath.SkipDir
+		}
+
+		return watcher.ErrSkip
+	}
+}
+
+// addNonRecursive registers dir which gets watched without its subdirectories
+func (im *ignoreMatcher) addNonRecursive(dir string) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	im.nonRecursive[dir] = true
+}
+
+func (im *ignoreMatcher) isNonRecursive(dir string) bool {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	return im.nonRecursive[dir]
+}
@@ -0,0 +1,157 @@
+package polywatch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIgnorePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		matched bool
+	}{
+		// Unanchored patterns match at any depth
+		{"*.log", "a.log", false, true},
+		{"*.log", "dir/a.log", false, true},
+		{"*.log", "a.log.txt", false, false},
+		{"foo", "a/b/foo", true, true},
+
+		// A leading or middle slash anchors the pattern to base
+		{"/root.txt", "root.txt", false, true},
+		{"/root.txt", "dir/root.txt", false, false},
+		{"doc/*.md", "doc/a.md", false, true},
+		{"doc/*.md", "doc/x/a.md", false, false},
+		{"doc/*.md", "x/doc/a.md", false, false},
+
+		// Directory-only patterns
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "a/build", true, true},
+
+		// Double stars
+		{"**/foo", "foo", false, true},
+		{"**/foo", "a/b/foo", false, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**/b", "a/xb", false, false},
+		{"abc/**", "abc/x", false, true},
+		{"abc/**", "abc/x/y", false, true},
+		{"abc/**", "abc", true, false},
+		{"foo**bar", "fooxbar", false, true},
+		{"foo**bar", "foo/bar", false, false},
+
+		// Wildcards & character classes
+		{"?.txt", "a.txt", false, true},
+		{"?.txt", "ab.txt", false, false},
+		{"?.txt", "/.txt", false, false},
+		{"[abc].go", "b.go", false, true},
+		{"[abc].go", "d.go", false, false},
+		{"[!abc].go", "d.go", false, true},
+		{"[!abc].go", "a.go", false, false},
+		{"[a-c]x", "bx", false, true},
+		{"a[b", "a[b", false, true},
+
+		// Escapes & whitespace
+		{`\#hash`, "#hash", false, true},
+		{`\!bang`, "!bang", false, true},
+		{`\*`, "*", false, true},
+		{`\*`, "a", false, false},
+		{`foo\ `, "foo ", false, true},
+		{"trailing   ", "trailing", false, true},
+		{"crlf.txt\r", "crlf.txt", false, true},
+
+		// Regexp metacharacters are literal
+		{"a+b(c).txt", "a+b(c).txt", false, true},
+		{"a.c", "abc", false, false},
+	}
+
+	for _, tt := range tests {
+		il := parseIgnoreList("/project", strings.NewReader(tt.pattern))
+		matched, ignored := il.match(tt.path, tt.isDir)
+		if matched != tt.matched || ignored != tt.matched {
+			t.Errorf("pattern %q on %q (dir: %v): expected matched %v, got matched %v & ignored %v",
+				tt.pattern, tt.path, tt.isDir, tt.matched, matched, ignored)
+		}
+	}
+}
+
+func TestIgnorePatternSkipped(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "!", "/", "!/"} {
+		if _, ok := parseIgnorePattern(line); ok {
+			t.Errorf("expected %q to be skipped", line)
+		}
+	}
+}
+
+func TestIgnoreListPrecedence(t *testing.T) {
+	tests := []struct {
+		list    string
+		path    string
+		matched bool
+		ignored bool
+	}{
+		{"*.log\n!keep.log", "keep.log", true, false},
+		{"*.log\n!keep.log", "other.log", true, true},
+		{"!keep.log\n*.log", "keep.log", true, true},
+		{"*.log\n!keep.log", "a.txt", false, false},
+		{"# comment\n\n*.log", "a.log", true, true},
+	}
+
+	for _, tt := range tests {
+		il := parseIgnoreList("/project", strings.NewReader(tt.list))
+		matched, ignored := il.match(tt.path, false)
+		if matched != tt.matched || ignored != tt.ignored {
+			t.Errorf("list %q on %q: expected matched %v & ignored %v, got %v & %v",
+				tt.list, tt.path, tt.matched, tt.ignored, matched, ignored)
+		}
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	project := t.TempDir()
+	files := map[string]string{
+		".gitignore":     "*.tmp\n!keep.tmp\n",
+		"sub/.gitignore": "keep.tmp\n",
+		".pwignore":      "!important.tmp\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(project, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	im := newIgnoreMatcher(project, []string{".gitignore"}, []string{"bin/app"})
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"a.tmp", false, true},
+		{"a.go", false, false},
+		{"keep.tmp", false, false},
+		// Ignore files of subdirectories take precedence
+		{"sub/keep.tmp", false, true},
+		{"sub/a.tmp", false, true},
+		// Project ignore file takes precedence over others
+		{"important.tmp", false, false},
+		{"sub/important.tmp", false, false},
+		// Outputs of the command
+		{"bin/app", false, true},
+		{"bin/other", false, false},
+		{"sub", true, false},
+	}
+
+	for _, tt := range tests {
+		if ignored := im.ignored(filepath.Join(project, tt.path), tt.isDir); ignored != tt.ignored {
+			t.Errorf("%s: expected ignored %v, got %v", tt.path, tt.ignored, ignored)
+		}
+	}
+}
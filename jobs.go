@@ -0,0 +1,231 @@
+package polywatch
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/radovskyb/watcher"
+)
+
+// jobPool bounds number of per-file jobs running at the same time. A path which already has a job waiting for a slot
+// doesn't get queued again
+type jobPool struct {
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu     sync.Mutex
+	queued map[string]bool
+	// batches is number of batches having running jobs; failed is whether any of their jobs has failed
+	batches int
+	failed  bool
+}
+
+func newJobPool(concurrency int) *jobPool {
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU()
+	}
+
+	return &jobPool{
+		sem:    make(chan struct{}, concurrency),
+		queued: make(map[string]bool),
+	}
+}
+
+func (jp *jobPool) enqueue(path string) bool {
+	jp.mu.Lock()
+	defer jp.mu.Unlock()
+
+	if jp.queued[path] {
+		return false
+	}
+	jp.queued[path] = true
+
+	return true
+}
+
+func (jp *jobPool) dequeue(path string) {
+	jp.mu.Lock()
+	defer jp.mu.Unlock()
+
+	delete(jp.queued, path)
+}
+
+// begin reports whether the batch is the first one of a run, which lasts until all of running batches are finished
+func (jp *jobPool) begin() bool {
+	jp.mu.Lock()
+	defer jp.mu.Unlock()
+
+	jp.batches++
+
+	return jp.batches == 1
+}
+
+// end reports whether the batch is the last one of a run & if so whether the run has succeeded
+func (jp *jobPool) end(failed bool) (last, success bool) {
+	jp.mu.Lock()
+	defer jp.mu.Unlock()
+
+	jp.batches--
+	jp.failed = jp.failed || failed
+	if jp.batches > 0 {
+		return false, false
+	}
+
+	success = !jp.failed
+	jp.failed = false
+
+	return true, success
+}
+
+// wait blocks until all of the jobs are finished
+func (jp *jobPool) wait() {
+	jp.wg.Wait()
+}
+
+// runJobs runs a job per changed file of the batch without interrupting jobs of previous batches. Directories & removed
+// files are skipped since there's nothing to run the command on. Failures get reported once all jobs of the batch finish
+func (pw *polyWatcher) runJobs(ctx context.Context, cs changeSet) error {
+	var (
+		batch  sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+		jobs   int
+	)
+
+	if pw.jobs.begin() {
+		pw.publish(runStarted, false)
+	}
+
+	for _, c := range cs {
+		if c.IsDir || c.Op == watcher.Remove {
+			continue
+		}
+
+		if !pw.jobs.enqueue(c.Path) {
+			pw.lg.Printf("job of %s is already queued\n", c.Path)
+			continue
+		}
+
+		pw.runs++
+		cmd, list, err := pw.jobCommand(changeSet{c})
+		if err != nil {
+			pw.jobs.dequeue(c.Path)
+			pw.lg.Printf("unable to prepare job of %s: %s\n", c.Path, err)
+
+			mu.Lock()
+			failed = append(failed, c.Path)
+			mu.Unlock()
+			continue
+		}
+
+		jobs++
+		batch.Add(1)
+		pw.jobs.wg.Add(1)
+		go func(path string) {
+			defer pw.jobs.wg.Done()
+			defer batch.Done()
+			defer func() {
+				if list != "" {
+					_ = os.Remove(list)
+				}
+			}()
+
+			select {
+			case pw.jobs.sem <- struct{}{}:
+				defer func() { <-pw.jobs.sem }()
+			case <-ctx.Done():
+				pw.jobs.dequeue(path)
+				return
+			}
+			pw.jobs.dequeue(path)
+
+			if err := pw.runJob(ctx, cmd); err != nil {
+				pw.lg.Printf("job of %s failed: %s\n", path, err)
+
+				mu.Lock()
+				failed = append(failed, path)
+				mu.Unlock()
+			}
+		}(c.Path)
+	}
+
+	if jobs == 0 && len(failed) == 0 {
+		pw.lg.Println("no changed file to run a job for")
+		if last, success := pw.jobs.end(false); last {
+			pw.publish(runFinished, success)
+		}
+
+		return nil
+	}
+
+	pw.jobs.wg.Add(1)
+	go func() {
+		defer pw.jobs.wg.Done()
+
+		batch.Wait()
+		if len(failed) > 0 {
+			pw.lg.Printf("%d of %d job(s) failed: %s\n", len(failed), jobs, strings.Join(failed, ", "))
+		} else {
+			pw.lg.Printf("%d job(s) succeeded\n", jobs)
+		}
+
+		if last, success := pw.jobs.end(len(failed) > 0); last {
+			pw.publish(runFinished, success)
+		}
+	}()
+
+	return nil
+}
+
+func (pw *polyWatcher) jobCommand(cs changeSet) (*exec.Cmd, string, error) {
+	script, err := renderExec(pw.tpl, newExecData(pw.cfg.Name, pw.runs, cs, pw.captures))
+	if err != nil {
+		return nil, "", err
+	}
+
+	env, list, err := cs.env(pw.cfg.Name, pw.cfg.Command.ChangedFilesList)
+	if err != nil {
+		pw.lg.Printf("unable to write list of changed files: %s\n", err)
+	}
+
+	cmd := pw.command(script)
+	cmd.Env = append(append([]string{}, pw.cfg.Command.Env...), env...)
+
+	return cmd, list, nil
+}
+
+// runJob runs cmd to completion. Job gets killed only when the watcher is stopping
+func (pw *polyWatcher) runJob(ctx context.Context, cmd *exec.Cmd) error {
+	untrack := func() {}
+	if pw.writes != nil {
+		untrack = pw.writes.track()
+	}
+
+	if err := cmd.Start(); err != nil {
+		untrack()
+
+		return err
+	}
+
+	var err error
+	exited := make(chan struct{})
+	go func() {
+		err = cmd.Wait()
+		untrack()
+		close(exited)
+	}()
+
+	select {
+	case <-exited:
+		return err
+
+	case <-ctx.Done():
+		sent := pw.terminate(cmd.Process.Pid, exited)
+
+		return handleWaitError(err, sent...)
+	}
+}
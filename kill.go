@@ -0,0 +1,135 @@
+package polywatch
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// killStage sends signal to the process group & waits for it to exit. Zero wait means waiting until it exits
+type killStage struct {
+	signal os.Signal
+	wait   time.Duration
+}
+
+// killStages returns stages of killing the command. Unless a sequence is configured, process group gets SIGKILL when it
+// survives the kill timeout
+func (pw *polyWatcher) killStages() []killStage {
+	if len(pw.cfg.Kill.Sequence) > 0 {
+		stages := make([]killStage, len(pw.cfg.Kill.Sequence))
+		for i, ks := range pw.cfg.Kill.Sequence {
+			stages[i] = killStage{signal: ks.Signal, wait: ks.Wait}
+		}
+
+		return stages
+	}
+
+	if pw.cfg.Kill.Timeout <= 0 {
+		return []killStage{{signal: pw.cfg.Kill.Signal}}
+	}
+
+	return []killStage{
+		{signal: pw.cfg.Kill.Signal, wait: pw.cfg.Kill.Timeout},
+		{signal: syscall.SIGKILL},
+	}
+}
+
+// terminate takes kill stages on process group of pid until exited is closed & returns signals which have been sent;
+// The last one belongs to the stage which terminated it
+func (pw *polyWatcher) terminate(pid int, exited <-chan struct{}) []os.Signal {
+	var sent []os.Signal
+	for i, st := range pw.killStages() {
+		if i > 0 {
+			pw.lg.Printf("pid(%d) is still running, sending sig(%s)\n", pid, st.signal)
+		}
+
+		if err := signalGroup(pid, st.signal); err != nil {
+			pw.lg.Printf("unable to send signal to pid(%d): %s\n", pid, err)
+		}
+		sent = append(sent, st.signal)
+
+		if st.wait <= 0 {
+			break
+		}
+
+		select {
+		case <-exited:
+			return sent
+		case <-time.After(st.wait):
+		}
+	}
+
+	<-exited
+
+	return sent
+}
+
+// stop runs the kill command & reports whether process of pid has exited within the kill command timeout. The kill
+// command itself gets killed when it's still running by then. It's meant just for the command, not for jobs, builds or
+// probes
+func (pw *polyWatcher) stop(pid int, exited <-chan struct{}) bool {
+	timeout := time.NewTimer(pw.cfg.Kill.CommandTimeout)
+	defer timeout.Stop()
+
+	cmd := pw.command(pw.cfg.Kill.Command)
+	cmd.Env = append(append([]string{}, pw.cfg.Command.Env...),
+		fmt.Sprintf("%s=%s", EnvWatcher, pw.cfg.Name),
+		fmt.Sprintf("%s=%d", EnvPid, pid),
+	)
+	if err := cmd.Start(); err != nil {
+		pw.lg.Printf("unable to run kill command: %s\n", err)
+
+		return false
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			pw.lg.Printf("kill command failed: %s\n", err)
+
+			return false
+		}
+
+		select {
+		case <-exited:
+			return true
+		case <-timeout.C:
+			pw.lg.Printf("pid(%d) is still running %s after kill command\n", pid, pw.cfg.Kill.CommandTimeout)
+
+			return false
+		}
+
+	case <-exited:
+		// Let the kill command finish its own cleanup
+		select {
+		case <-done:
+		case <-timeout.C:
+			_ = signalGroup(cmd.Process.Pid, syscall.SIGKILL)
+			<-done
+		}
+
+		return true
+
+	case <-timeout.C:
+		pw.lg.Printf("kill command timed out after %s\n", pw.cfg.Kill.CommandTimeout)
+		_ = signalGroup(cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+
+		return false
+	}
+}
+
+func signalGroup(pid int, sig os.Signal) error {
+	group, err := os.FindProcess(-1 * pid)
+	if err != nil {
+		return err
+	}
+
+	return group.Signal(sig)
+}
@@ -4,17 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"text/template"
 
 	"github.com/radovskyb/watcher"
-	"github.com/zmwangx/debounce"
 
 	"github.com/pouyanh/polywatch/config"
 )
@@ -28,24 +31,52 @@ func Start() error {
 	defer stop()
 
 	cfg := config.MustLoad()
-	wg := sync.WaitGroup{}
-	for _, cw := range cfg.Watchers {
+	b := newBus()
+	watchers := make([]*polyWatcher, len(cfg.Watchers))
+	byName := make(map[string]*polyWatcher)
+	for i, cw := range cfg.Watchers {
 		w, err := newPolyWatcher(cw)
 		if err != nil {
 			return err
 		}
+		w.bus = b
+		if cw.On.Watcher != "" {
+			w.chain = newChain(ctx, w)
+			b.subscribe(cw.On.Watcher, w.chain.notify)
+		}
+
+		watchers[i] = w
+		byName[cw.Name] = w
+	}
+
+	for _, w := range watchers {
+		for _, name := range w.cfg.DependsOn {
+			dep := byName[name]
+			w.deps = append(w.deps, dep)
+			dep.dependents = append(dep.dependents, w)
+		}
+	}
 
+	if cfg.Webhook.Address != "" {
+		if err := serveWebhook(ctx, cfg.Webhook, byName); err != nil {
+			return err
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	for _, w := range watchers {
 		wg.Add(1)
-		go func() {
+		go func(w *polyWatcher) {
 			defer wg.Done()
 
 			if err := w.watch(ctx); err != nil {
 				stop()
 			}
-		}()
+		}(w)
 	}
 
 	bindSignals(stop, syscall.SIGTERM, syscall.SIGINT)
+	bindTriggerSignals(ctx, watchers, cfg.TriggerFile)
 
 	wg.Wait()
 
@@ -65,39 +96,95 @@ func bindSignals(fn func(), ss ...os.Signal) {
 type polyWatcher struct {
 	cfg config.Watcher
 
-	w   *watcher.Watcher
-	lg  *log.Logger
-	cmd *exec.Cmd
+	w       *watcher.Watcher
+	lg      *log.Logger
+	sources []*commandSource
+	writes  *writeTracker
+	jobs    *jobPool
+	sup     *supervisor
+	bus     *bus
+	chain   *chain
+
+	deps       []*polyWatcher
+	dependents []*polyWatcher
+	readyOnce  sync.Once
+	// ready is closed once the watcher gets ready for the first time
+	ready chan struct{}
+	// stopped is closed once the watcher is stopped & its command is killed
+	stopped chan struct{}
+
+	hooks []watcher.FilterFileHookFunc
+	tpl   *template.Template
+	// build is nil when there's nothing to build before restarts
+	build    *template.Template
+	captures []*regexp.Regexp
+	rules    []rule
+
+	// mu serializes updates since rate limited handlers may get invoked concurrently
+	mu   sync.Mutex
+	proc *process
+	runs int
+	// list is the temporary file listing changed files of the current run
+	list string
 }
 
 func newPolyWatcher(cfg config.Watcher) (*polyWatcher, error) {
 	lg := log.New(os.Stderr, fmt.Sprintf("poly-watcher[%s]: ", cfg.Name), log.LstdFlags)
 
+	project, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
 	w := watcher.New()
+	im := newIgnoreMatcher(project, cfg.Watch.IgnoreFiles, cfg.Command.Outputs)
 	for _, wf := range cfg.Watch.Files {
-		path := filepath.Clean(os.ExpandEnv(wf.Path))
+		if !wf.Recursive && wf.FromCommand == "" {
+			path, err := filepath.Abs(os.ExpandEnv(wf.Path))
+			if err != nil {
+				return nil, err
+			}
 
-		var err error
-		if wf.Recursive {
-			err = w.AddRecursive(path)
-		} else {
-			err = w.Add(path)
+			im.addNonRecursive(path)
 		}
+	}
 
+	// Hooks are kept in order to walk files just like the watcher does
+	var hooks []watcher.FilterFileHookFunc
+	addFilterHook := func(h watcher.FilterFileHookFunc) {
+		w.AddFilterHook(h)
+		hooks = append(hooks, h)
+	}
+
+	// Ignore hook has to come first, otherwise directories skipped by other filters won't get pruned
+	addFilterHook(im.hook())
+
+	// State file is written on shutdown, so it'd be reported as a change on every startup
+	if cfg.Watch.Snapshot.Enabled {
+		state, err := filepath.Abs(cfg.Watch.Snapshot.File)
 		if err != nil {
 			return nil, err
 		}
+
+		addFilterHook(fileFilterPaths(state, state+".tmp"))
 	}
 
+	// Patterns of inclusive filename filters provide capture groups to command template
+	var captures []*regexp.Regexp
 	for _, wf := range cfg.Watch.Filters {
 		switch wf.On {
 		case config.WatchFilterScopeFilename:
 			switch wf.Type {
 			case config.WatchFilterTypeRegex:
-				w.AddFilterHook(fileFilterRegex(wf.Include, wf.List...))
+				addFilterHook(fileFilterRegex(wf.Include, wf.List...))
+				if wf.Include {
+					for _, pattern := range wf.List {
+						captures = append(captures, regexp.MustCompile(pattern))
+					}
+				}
 
 			case config.WatchFilterTypeList:
-				w.AddFilterHook(fileFilterList(wf.Include, wf.List...))
+				addFilterHook(fileFilterList(wf.Include, wf.List...))
 
 			default:
 				return nil, ErrUnsupportedFilter
@@ -109,40 +196,200 @@ func newPolyWatcher(cfg config.Watcher) (*polyWatcher, error) {
 		}
 	}
 
+	var sources []*commandSource
+	for _, wf := range cfg.Watch.Files {
+		if wf.FromCommand != "" {
+			cs := newCommandSource(cfg.Command.Shell, cfg.Command.Env, wf.FromCommand, wf.Refresh, w, im, lg)
+			if _, err := cs.load(); err != nil {
+				return nil, err
+			}
+
+			sources = append(sources, cs)
+			continue
+		}
+
+		path := filepath.Clean(os.ExpandEnv(wf.Path))
+
+		var err error
+		if wf.Recursive {
+			err = w.AddRecursive(path)
+		} else {
+			err = w.Add(path)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tpl, err := config.ParseExec(cfg.Command.Exec)
+	if err != nil {
+		return nil, err
+	}
+
+	var build *template.Template
+	if cfg.Command.Build != "" {
+		if build, err = config.ParseExec(cfg.Command.Build); err != nil {
+			return nil, err
+		}
+	}
+
+	rules, err := newRules(project, cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+
 	pw := &polyWatcher{
-		cfg: cfg,
+		cfg:   cfg,
+		tpl:   tpl,
+		build: build,
+
+		w:        w,
+		lg:       lg,
+		sources:  sources,
+		hooks:    hooks,
+		captures: captures,
+		rules:    rules,
+
+		ready:   make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	if cfg.Command.IgnoreOwnWrites {
+		pw.writes = newWriteTracker(2 * cfg.Watch.Interval)
+	}
 
-		w:  w,
-		lg: lg,
+	if cfg.Command.Mode == config.CommandModePerFile {
+		pw.jobs = newJobPool(cfg.Command.Concurrency)
 	}
 
-	pw.renewCommand()
+	if cfg.Command.Restart != config.RestartNever {
+		pw.sup = newSupervisor(cfg.Command)
+	}
 
 	return pw, nil
 }
 
-func (pw *polyWatcher) renewCommand() {
+// process is a started command which gets waited for in background
+type process struct {
+	*exec.Cmd
+
+	done chan struct{}
+	err  error
+	// killed is set when the process is being killed by the watcher, so its exit isn't reported as a run result
+	killed atomic.Bool
+	// reported is set once the run result of the process is published, either on passing the probe or on exit
+	reported atomic.Bool
+
+	// respawn is an unstarted copy of the command & tail is the latest output of it, they're set just when the command
+	// gets restarted on exit
+	respawn *exec.Cmd
+	tail    *tailBuffer
+}
+
+// start starts cmd as the running command & reports its result once it exits on its own
+func (pw *polyWatcher) start(ctx context.Context, cmd *exec.Cmd) error {
+	p := &process{Cmd: cmd, done: make(chan struct{})}
+	if pw.sup != nil {
+		p.respawn = cloneCommand(cmd)
+		p.tail = newTailBuffer(maxTail)
+		cmd.Stdout = io.MultiWriter(cmd.Stdout, p.tail)
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, p.tail)
+	}
+
+	untrack := func() {}
+	if pw.writes != nil {
+		untrack = pw.writes.track()
+	}
+
+	pw.publish(runStarted, false)
+	if err := cmd.Start(); err != nil {
+		untrack()
+		pw.publish(runFinished, false)
+
+		return err
+	}
+
+	go func() {
+		p.err = cmd.Wait()
+		untrack()
+		close(p.done)
+
+		if !p.killed.Load() {
+			pw.lg.Printf("command pid(%d) exited: %s\n", cmd.Process.Pid, cmd.ProcessState)
+			pw.finish(p, p.err == nil)
+
+			if pw.sup != nil && pw.sup.wants(p.err) {
+				pw.restart(ctx, p)
+			}
+		}
+	}()
+	pw.proc = p
+	pw.probe(ctx, p)
+
+	return nil
+}
+
+// finish publishes the run result of p unless it's already published, so a service which has passed its probe isn't
+// reported again on exit
+func (pw *polyWatcher) finish(p *process, success bool) {
+	if p.reported.CompareAndSwap(false, true) {
+		pw.publish(runFinished, success)
+	}
+}
+
+func (pw *polyWatcher) resetCommand() {
 	// todo: support multiline command
 
-	rawcmd := strings.Split(pw.cfg.Command.Shell, " ")
-	rawcmd = append(rawcmd, pw.cfg.Command.Exec)
+	if pw.list != "" {
+		_ = os.Remove(pw.list)
+		pw.list = ""
+	}
+
+	pw.proc = nil
+}
 
-	cmd := exec.Command(rawcmd[0], rawcmd[1:]...)
+func (pw *polyWatcher) command(script string) *exec.Cmd {
+	cmd := shellCommand(pw.cfg.Command.Shell, script)
 	cmd.Env = pw.cfg.Command.Env
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	pw.cmd = cmd
+	return cmd
+}
+
+func shellCommand(shell, script string) *exec.Cmd {
+	rawcmd := strings.Split(shell, " ")
+	rawcmd = append(rawcmd, script)
+
+	return exec.Command(rawcmd[0], rawcmd[1:]...)
 }
 
 func (pw *polyWatcher) watch(ctx context.Context) error {
+	defer close(pw.stopped)
+	if !pw.awaitDependencies(ctx) {
+		return nil
+	}
+
 	for path, f := range pw.w.WatchedFiles() {
 		pw.lg.Printf("%s: %s\n", path, f.Name())
 	}
 
+	// Jobs of per-file mode are bound to this context, so they get killed once the watcher stops for any reason
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+
 	chErr := make(chan error)
-	defer close(chErr)
+	done := make(chan struct{})
+	defer close(done)
+
+	report := func(err error) {
+		select {
+		case chErr <- err:
+		case <-done:
+		}
+	}
 
 	uh := pw.updateHandler()
 	go func() {
@@ -150,31 +397,93 @@ func (pw *polyWatcher) watch(ctx context.Context) error {
 			select {
 			case e := <-pw.w.Event:
 				pw.lg.Printf("event received: %+v\n", e)
+				if pw.writes != nil && e.Path != "" && pw.writes.wrote(eventTime(e)) {
+					pw.lg.Printf("ignoring event of file written by the command: %s\n", e.Path)
+					continue
+				}
+
+				pw.refreshSources(e)
+				if pw.chain != nil && pw.chain.hold(update{ctx: ctx, event: e}) {
+					pw.lg.Printf("deferring event until %s finishes: %s\n", pw.cfg.On.Watcher, e.Path)
+					continue
+				}
+
 				err := uh(ctx, e)
 				if err != nil {
 					pw.lg.Printf("error occurred during handling update: %s\n", err)
 				}
 			case err := <-pw.w.Error:
-				chErr <- err
+				if errors.Is(err, watcher.ErrWatchedFileDeleted) && pw.sourcesStale() {
+					// Removal of a file listed by a command just means that the list has to get refreshed
+					continue
+				}
+
+				report(err)
 			case <-pw.w.Closed:
 				return
 			}
 		}
 	}()
 
+	for _, cs := range pw.sources {
+		go cs.run(ctx, pw.cfg.Watch.Interval)
+	}
+
 	go func() {
 		go func() {
 			pw.w.Wait()
 
 			pw.lg.Println("started")
+
+			// Startup events get handled as a single batch, so offline changes restart the command just once
+			ee := pw.startupEvents()
+			if len(ee) == 0 && pw.cfg.Command.RunOnStart == config.RunOnStartChanged {
+				// Nothing is changed since previous session, so there's nothing to wait for
+				pw.markReady()
+			}
+			if len(ee) == 0 || ctx.Err() != nil {
+				return
+			}
+
+			uu := make([]update, len(ee))
+			for i, e := range ee {
+				pw.lg.Printf("startup event: %+v\n", e)
+				uu[i] = update{ctx: ctx, event: e}
+			}
+
+			if pw.chain != nil && pw.chain.hold(uu...) {
+				pw.lg.Printf("deferring %d startup event(s) until %s finishes\n", len(uu), pw.cfg.On.Watcher)
+				return
+			}
+
+			if err := pw.handleUpdate(uu...); err != nil {
+				pw.lg.Printf("error occurred during handling update: %s\n", err)
+			}
 		}()
 
 		pw.lg.Println("starting...")
-		chErr <- pw.w.Start(pw.cfg.Watch.Interval)
+		report(pw.w.Start(pw.cfg.Watch.Interval))
 	}()
 
 	defer pw.w.Close()
-	defer func() { _ = pw.kill(ctx) }()
+	defer func() {
+		if parent.Err() != nil {
+			// Dependents are stopping too, since it's a shutdown
+			pw.awaitDependents()
+		}
+
+		cancel()
+		if pw.jobs != nil {
+			pw.jobs.wait()
+		}
+
+		pw.mu.Lock()
+		defer pw.mu.Unlock()
+
+		_ = pw.kill(ctx)
+	}()
+	defer pw.persistSnapshot()
+	defer pw.schedule(ctx)()
 	select {
 	case err := <-chErr:
 		pw.lg.Printf("error occurred during watch: %s", err)
@@ -187,86 +496,256 @@ func (pw *polyWatcher) watch(ctx context.Context) error {
 	return nil
 }
 
-type updateHandler func(ctx context.Context, event watcher.Event) error
+// startupEvents returns events which get handled on start according to the run-on-start policy. Changes made since
+// previous session are included when snapshot is enabled
+func (pw *polyWatcher) startupEvents() []watcher.Event {
+	var ee []watcher.Event
+	known := false
+	if pw.cfg.Watch.Snapshot.Enabled {
+		prev, err := loadSnapshot(pw.cfg.Watch.Snapshot.File, pw.cfg.Name)
+		if err != nil {
+			pw.lg.Printf("unable to load snapshot: %s\n", err)
+		} else if prev != nil {
+			known = true
+
+			files := pw.w.WatchedFiles()
+			ee = takeSnapshot(files, pw.cfg.Watch.Snapshot.Hash).diff(prev, files)
+			pw.lg.Printf("%d change(s) since previous session\n", len(ee))
+		}
+	}
 
-func (pw *polyWatcher) updateHandler() updateHandler {
-	var uh func(uu ...update) error
-	switch pw.cfg.RateLimit.Strategy {
-	case config.RateLimitStrategyDebounce:
-		uh, _ = debounce.DebounceWithCustomSignature(pw.handleUpdate, pw.cfg.RateLimit.Wait)
+	// Manual-only watchers just run when they're triggered
+	if len(pw.cfg.Watch.Files) == 0 {
+		return nil
+	}
 
-	case config.RateLimitStrategyThrottle:
-		uh, _ = debounce.ThrottleWithCustomSignature(pw.handleUpdate, pw.cfg.RateLimit.Wait)
+	switch pw.cfg.Command.RunOnStart {
+	case config.RunOnStartNever:
+		return nil
 
-	//case config.RateLimitStrategyAudit:
-	//case config.RateLimitStrategySample:
+	case config.RunOnStartChanged:
+		if known {
+			return ee
+		}
+	}
+
+	if len(ee) == 0 {
+		ee = append(ee, triggerEvent("start"))
+	}
+
+	return ee
+}
+
+func (pw *polyWatcher) persistSnapshot() {
+	if !pw.cfg.Watch.Snapshot.Enabled {
+		return
+	}
 
+	snap := takeSnapshot(pw.w.WatchedFiles(), pw.cfg.Watch.Snapshot.Hash)
+	if err := saveSnapshot(pw.cfg.Watch.Snapshot.File, pw.cfg.Name, snap); err != nil {
+		pw.lg.Printf("unable to save snapshot: %s\n", err)
+	}
+}
+
+func (pw *polyWatcher) refreshSources(e watcher.Event) {
+	switch e.Op {
+	case watcher.Create, watcher.Remove, watcher.Rename, watcher.Move:
 	default:
-		uh = pw.handleUpdate
+		return
 	}
 
-	return func(ctx context.Context, event watcher.Event) error {
-		return uh(update{
-			ctx:   ctx,
-			event: event,
-		})
+	for _, cs := range pw.sources {
+		if cs.owns(e.Path) || cs.owns(e.OldPath) {
+			cs.requestRefresh()
+		}
 	}
 }
 
-type update struct {
-	ctx   context.Context
-	event watcher.Event
+func (pw *polyWatcher) sourcesStale() bool {
+	for _, cs := range pw.sources {
+		if cs.stale() {
+			cs.requestRefresh()
+
+			return true
+		}
+	}
+
+	return false
 }
 
 func (pw *polyWatcher) handleUpdate(uu ...update) error {
-	u := uu[0]
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	u := uu[len(uu)-1]
+	cs := newChangeSet(uu)
+	if len(pw.cfg.Actions) > 0 {
+		pw.publish(runStarted, false)
+	}
+
+	if err := pw.runActions(u.ctx, cs); err != nil {
+		pw.publish(runFinished, false)
+		pw.lg.Printf("%s\n", err)
+
+		return err
+	}
+
+	if pw.jobs != nil {
+		return pw.runJobs(u.ctx, cs)
+	}
 
-	return pw._handleUpdate(u.ctx, u.event)
+	return pw._handleUpdate(u.ctx, cs)
 }
 
-func (pw *polyWatcher) _handleUpdate(ctx context.Context, event watcher.Event) error {
-	pw.lg.Println("updating...")
+func (pw *polyWatcher) _handleUpdate(ctx context.Context, cs changeSet) error {
+	pw.lg.Printf("updating due to %d changed file(s)...\n", len(cs))
+
+	// Batches which aren't bound to any file, e.g. the one on start, just restart the command
+	if len(pw.rules) > 0 && len(cs) > 0 {
+		r, ok := pw.route(cs)
+		if !ok {
+			pw.lg.Println("no rule matched")
+			if len(pw.cfg.Actions) > 0 {
+				// Run of the actions is over
+				pw.publish(runFinished, true)
+			}
+			return nil
+		}
+
+		restart, err := pw.applyRule(ctx, r, cs)
+		if err != nil {
+			pw.publish(runFinished, false)
+			pw.lg.Printf("%s; keeping the running command\n", err)
+			return err
+		}
+
+		if !restart {
+			pw.publish(runFinished, true)
+			return nil
+		}
+	}
+
+	if pw.cfg.Command.Exec == "" {
+		// Nothing to run besides actions
+		pw.publish(runFinished, true)
+		return nil
+	}
+
+	if pw.build != nil {
+		if err := pw.runBuild(ctx, cs); err != nil {
+			pw.publish(runFinished, false)
+			pw.lg.Printf("%s; keeping the running command\n", err)
+			return nil
+		}
+	}
+
+	if pw.cfg.Command.OnChange == config.OnChangeSignal && pw.reload() {
+		pw.publish(runFinished, true)
+		return nil
+	}
+
+	// Command is prepared before killing the previous one, so it keeps running if that fails
+	script, err := renderExec(pw.tpl, newExecData(pw.cfg.Name, pw.runs+1, cs, pw.captures))
+	if err != nil {
+		pw.publish(runFinished, false)
+		pw.lg.Printf("unable to render command: %s; keeping the running command\n", err)
+		return nil
+	}
 
-	err := pw.kill(ctx)
+	env, list, err := cs.env(pw.cfg.Name, pw.cfg.Command.ChangedFilesList)
 	if err != nil {
+		pw.lg.Printf("unable to write list of changed files: %s\n", err)
+	}
+
+	cmd := pw.command(script)
+	cmd.Env = append(append([]string{}, pw.cfg.Command.Env...), env...)
+
+	if err := pw.kill(ctx); err != nil {
 		pw.lg.Printf("unable to kill previous command: %s", err)
 	}
 
-	return pw.cmd.Start()
+	pw.runs++
+	pw.list = list
+
+	if pw.sup != nil {
+		// Changes give crashing commands another chance
+		pw.sup.reset()
+	}
+
+	return pw.start(ctx, cmd)
+}
+
+// reload sends the configured signal to the running command instead of restarting it & reports whether it's done.
+// Command which is not alive has to get started again
+func (pw *polyWatcher) reload() bool {
+	if pw.proc == nil {
+		return false
+	}
+
+	select {
+	case <-pw.proc.done:
+		pw.lg.Printf("command pid(%d) isn't running anymore, restarting it\n", pw.proc.Process.Pid)
+		return false
+	default:
+	}
+
+	if err := signalGroup(pw.proc.Process.Pid, pw.cfg.Command.Signal); err != nil {
+		pw.lg.Printf("unable to send sig(%s) to command pid(%d): %s; restarting it\n",
+			pw.cfg.Command.Signal, pw.proc.Process.Pid, err)
+		return false
+	}
+
+	pw.lg.Printf("sent sig(%s) to command pid(%d)\n", pw.cfg.Command.Signal, pw.proc.Process.Pid)
+
+	return true
 }
 
 func (pw *polyWatcher) kill(ctx context.Context) error {
-	if pw.cmd.Process == nil {
+	if pw.proc == nil {
 		return nil
 	}
 
-	if pw.cmd.Process.Pid < 1 {
+	defer pw.resetCommand()
+
+	select {
+	case <-pw.proc.done:
+		// Already exited on its own
 		return nil
+	default:
 	}
 
-	pw.lg.Printf("killing previous command pid(%d) with sig(%s)", pw.cmd.Process.Pid, pw.cfg.Kill.Signal)
+	pw.proc.killed.Store(true)
 
-	// todo: apply kill timeout
-	group, err := os.FindProcess(-1 * pw.cmd.Process.Pid)
-	if err == nil {
-		err = group.Signal(pw.cfg.Kill.Signal)
-		if err != nil {
-			pw.lg.Printf("unable to send signal to previous command: %s", err)
+	if pw.cfg.Kill.Command == "" {
+		pw.lg.Printf("killing previous command pid(%d) with sig(%s)", pw.proc.Process.Pid, pw.killStages()[0].signal)
+	} else {
+		pw.lg.Printf("killing previous command pid(%d) using kill command", pw.proc.Process.Pid)
+		if pw.stop(pw.proc.Process.Pid, pw.proc.done) {
+			pw.lg.Printf("previous command pid(%d) stopped by kill command", pw.proc.Process.Pid)
+
+			return handleWaitError(pw.proc.err)
 		}
+
+		pw.lg.Printf("pid(%d) is still running, sending sig(%s)\n", pw.proc.Process.Pid, pw.killStages()[0].signal)
 	}
 
-	defer pw.renewCommand()
+	sent := pw.terminate(pw.proc.Process.Pid, pw.proc.done)
+	pw.lg.Printf("previous command pid(%d) terminated at stage %d by sig(%s)",
+		pw.proc.Process.Pid, len(sent), sent[len(sent)-1])
 
-	return handleWaitError(pw.cmd.Wait(), pw.cfg.Kill.Signal)
+	return handleWaitError(pw.proc.err, sent...)
 }
 
-func handleWaitError(err error, sig os.Signal) error {
+// handleWaitError treats termination by any of sent signals as a clean exit
+func handleWaitError(err error, sent ...os.Signal) error {
 	if e, ok := err.(*exec.ExitError); ok {
 		status := e.ProcessState.Sys().(syscall.WaitStatus)
 		if status.Signaled() {
 			// TODO: seperate windows and posix functionality and compare relevant types
-			if status.Signal().String() == sig.String() {
-				return nil
+			for _, sig := range sent {
+				if status.Signal().String() == sig.String() {
+					return nil
+				}
 			}
 		}
 	}
@@ -0,0 +1,451 @@
+package polywatch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"github.com/zmwangx/debounce"
+
+	"github.com/pouyanh/polywatch/config"
+)
+
+type updateHandler func(ctx context.Context, event watcher.Event) error
+
+func (pw *polyWatcher) updateHandler() updateHandler {
+	var uh func(uu ...update) error
+	switch pw.cfg.RateLimit.Key {
+	case config.RateLimitKeyPath:
+		uh = newKeyedLimiter(pw.cfg.RateLimit, pw.handleUpdate, func(u update) string {
+			return u.event.Path
+		}).call
+
+	default:
+		uh = newLimiter(pw.cfg.RateLimit, pw.handleUpdate).call
+	}
+
+	return func(ctx context.Context, event watcher.Event) error {
+		return uh(update{
+			ctx:   ctx,
+			event: event,
+		})
+	}
+}
+
+type update struct {
+	ctx   context.Context
+	event watcher.Event
+}
+
+// limiter is a rate limited function along with its controls
+type limiter struct {
+	call    func(uu ...update) error
+	pending func() bool
+	flush   func()
+}
+
+// newLimiter rate limits fn according to the strategy. Updates are accumulated between invocations, so fn receives
+// the whole batch instead of the latest update
+func newLimiter(cfg config.RateLimit, fn func(uu ...update) error) limiter {
+	var (
+		mu    sync.Mutex
+		batch []update
+	)
+
+	l := newStrategyLimiter(cfg, func(...update) error {
+		mu.Lock()
+		uu := batch
+		batch = nil
+		mu.Unlock()
+
+		if len(uu) == 0 {
+			// Already handled by a previous invocation
+			return nil
+		}
+
+		return fn(uu...)
+	})
+
+	call := l.call
+	l.call = func(uu ...update) error {
+		mu.Lock()
+		batch = append(batch, uu...)
+		mu.Unlock()
+
+		return call(uu...)
+	}
+
+	return l
+}
+
+func newStrategyLimiter(cfg config.RateLimit, fn func(uu ...update) error) limiter {
+	var (
+		uh  func(uu ...update) error
+		ctl debounce.ControlWithReturnValue[error]
+	)
+
+	switch cfg.Strategy {
+	case config.RateLimitStrategyDebounce:
+		uh, ctl = debounce.DebounceWithCustomSignature(fn, cfg.Wait,
+			debounce.WithLeading(cfg.Leading),
+			debounce.WithTrailing(cfg.Trailing),
+			debounce.WithMaxWait(cfg.MaxWait),
+		)
+
+	case config.RateLimitStrategyThrottle:
+		uh, ctl = debounce.ThrottleWithCustomSignature(fn, cfg.Wait)
+
+	case config.RateLimitStrategyAudit:
+		return audit(fn, cfg.Wait, realClock{})
+
+	case config.RateLimitStrategySample:
+		return sample(fn, cfg.Wait, realClock{})
+
+	case config.RateLimitStrategyTokenBucket:
+		return tokenBucket(fn, cfg.Burst, cfg.Wait, realClock{})
+
+	default:
+		// None, since unknown strategies are rejected when the config gets validated
+		return limiter{
+			call:    fn,
+			pending: func() bool { return false },
+			flush:   func() {},
+		}
+	}
+
+	return limiter{
+		call:    uh,
+		pending: ctl.Pending,
+		flush:   func() { _ = ctl.Flush() },
+	}
+}
+
+type keyedLimiterEntry struct {
+	limiter
+	used time.Time
+}
+
+// keyedLimiter keeps separate rate limiting state for each key. Number of kept states is bounded by MaxKeys; idle ones
+// get evicted first and if all of them are pending, the least recently used one gets flushed
+type keyedLimiter struct {
+	cfg config.RateLimit
+	fn  func(uu ...update) error
+	key func(u update) string
+
+	mu      sync.Mutex
+	entries map[string]*keyedLimiterEntry
+}
+
+func newKeyedLimiter(cfg config.RateLimit, fn func(uu ...update) error, key func(u update) string) *keyedLimiter {
+	return &keyedLimiter{
+		cfg: cfg,
+		fn:  fn,
+		key: key,
+
+		entries: make(map[string]*keyedLimiterEntry),
+	}
+}
+
+func (kl *keyedLimiter) call(uu ...update) error {
+	var err error
+	for _, u := range uu {
+		if e := kl.entry(kl.key(u)).call(u); e != nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+func (kl *keyedLimiter) entry(key string) limiter {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	e, ok := kl.entries[key]
+	if !ok {
+		if len(kl.entries) >= kl.cfg.MaxKeys {
+			kl.evict()
+		}
+
+		e = &keyedLimiterEntry{limiter: newLimiter(kl.cfg, kl.fn)}
+		kl.entries[key] = e
+	}
+	e.used = time.Now()
+
+	return e.limiter
+}
+
+func (kl *keyedLimiter) evict() {
+	var (
+		lru     string
+		lruUsed time.Time
+		found   bool
+	)
+
+	for key, e := range kl.entries {
+		if !e.pending() {
+			delete(kl.entries, key)
+			continue
+		}
+
+		if !found || e.used.Before(lruUsed) {
+			lru, lruUsed, found = key, e.used, true
+		}
+	}
+
+	if len(kl.entries) < kl.cfg.MaxKeys || !found {
+		return
+	}
+
+	// Flush in background since it invokes the handler
+	go kl.entries[lru].flush()
+	delete(kl.entries, lru)
+}
+
+// clock abstracts time in order to make timing of rate limiters testable
+type clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) stopper
+}
+
+type stopper interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) stopper {
+	return time.AfterFunc(d, f)
+}
+
+// audit invokes fn using the latest arguments when wait is elapsed since the first call of a window. Calls made
+// during the window don't extend it
+func audit(fn func(uu ...update) error, wait time.Duration, clk clock) limiter {
+	var (
+		mu     sync.Mutex
+		timer  stopper
+		last   []update
+		result error
+	)
+
+	fire := func() {
+		mu.Lock()
+		if timer == nil {
+			mu.Unlock()
+			return
+		}
+		timer = nil
+		args := last
+		last = nil
+		mu.Unlock()
+
+		err := fn(args...)
+
+		mu.Lock()
+		result = err
+		mu.Unlock()
+	}
+
+	return limiter{
+		call: func(uu ...update) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			last = uu
+			if timer == nil {
+				timer = clk.AfterFunc(wait, fire)
+			}
+
+			return result
+		},
+		pending: func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return timer != nil
+		},
+		flush: func() {
+			mu.Lock()
+			if timer != nil {
+				timer.Stop()
+			}
+			mu.Unlock()
+
+			fire()
+		},
+	}
+}
+
+// sample invokes fn periodically using the latest arguments if any call has been made since previous period.
+// Sampling starts by the first call and pauses after a period without calls
+func sample(fn func(uu ...update) error, wait time.Duration, clk clock) limiter {
+	var (
+		mu     sync.Mutex
+		timer  stopper
+		last   []update
+		has    bool
+		result error
+	)
+
+	var tick func()
+	tick = func() {
+		mu.Lock()
+		if !has {
+			timer = nil
+			mu.Unlock()
+			return
+		}
+		args := last
+		last, has = nil, false
+		timer = clk.AfterFunc(wait, tick)
+		mu.Unlock()
+
+		err := fn(args...)
+
+		mu.Lock()
+		result = err
+		mu.Unlock()
+	}
+
+	return limiter{
+		call: func(uu ...update) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			last, has = uu, true
+			if timer == nil {
+				timer = clk.AfterFunc(wait, tick)
+			}
+
+			return result
+		},
+		pending: func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return has
+		},
+		flush: func() {
+			mu.Lock()
+			if !has {
+				mu.Unlock()
+				return
+			}
+			args := last
+			last, has = nil, false
+			mu.Unlock()
+
+			_ = fn(args...)
+		},
+	}
+}
+
+// tokenBucket invokes fn immediately as long as there are tokens in the bucket. Bucket holds up to burst tokens & gets
+// a new one per refill. Calls made while it's empty are held & the latest one gets invoked as soon as a token is added
+func tokenBucket(fn func(uu ...update) error, burst int, refill time.Duration, clk clock) limiter {
+	var (
+		mu      sync.Mutex
+		tokens  = float64(burst)
+		updated = clk.Now()
+		timer   stopper
+		last    []update
+		result  error
+	)
+
+	// fillLocked adds tokens gained since last update
+	fillLocked := func() {
+		now := clk.Now()
+		if refill > 0 {
+			tokens += float64(now.Sub(updated)) / float64(refill)
+		} else {
+			tokens = float64(burst)
+		}
+		if tokens > float64(burst) {
+			tokens = float64(burst)
+		}
+		updated = now
+	}
+
+	invoke := func(args []update) {
+		err := fn(args...)
+
+		mu.Lock()
+		result = err
+		mu.Unlock()
+	}
+
+	var release func()
+	release = func() {
+		mu.Lock()
+		if timer == nil {
+			mu.Unlock()
+			return
+		}
+
+		fillLocked()
+		if tokens < 1 {
+			timer = clk.AfterFunc(time.Duration((1-tokens)*float64(refill)), release)
+			mu.Unlock()
+			return
+		}
+
+		tokens--
+		timer = nil
+		args := last
+		last = nil
+		mu.Unlock()
+
+		invoke(args)
+	}
+
+	return limiter{
+		call: func(uu ...update) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if timer == nil {
+				fillLocked()
+				if tokens >= 1 {
+					tokens--
+					mu.Unlock()
+					invoke(uu)
+					mu.Lock()
+
+					return result
+				}
+
+				timer = clk.AfterFunc(time.Duration((1-tokens)*float64(refill)), release)
+			}
+
+			// Wait for the next token
+			last = uu
+
+			return result
+		},
+		pending: func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return timer != nil
+		},
+		flush: func() {
+			mu.Lock()
+			if timer == nil {
+				mu.Unlock()
+				return
+			}
+			timer.Stop()
+			timer = nil
+			args := last
+			last = nil
+			mu.Unlock()
+
+			invoke(args)
+		},
+	}
+}
@@ -0,0 +1,256 @@
+package polywatch
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+type fakeTimer struct {
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func (t *fakeTimer) Stop() bool {
+	active := !t.stopped
+	t.stopped = true
+
+	return active
+}
+
+// fakeClock fires timers synchronously when it's advanced
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) stopper {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+
+	return t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+
+		var due *fakeTimer
+		for i, t := range c.timers {
+			if t.stopped {
+				continue
+			}
+
+			if !t.at.After(end) {
+				due = t
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			}
+			break
+		}
+
+		if due == nil {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+
+		c.now = due.at
+		due.stopped = true
+		c.mu.Unlock()
+
+		due.f()
+	}
+}
+
+// recorder records paths of the latest update of each invocation
+type recorder struct {
+	clk   *fakeClock
+	calls []string
+	at    []time.Duration
+}
+
+func (r *recorder) fn(uu ...update) error {
+	r.calls = append(r.calls, uu[len(uu)-1].event.Path)
+	r.at = append(r.at, r.clk.Now().Sub(time.Unix(0, 0)))
+
+	return nil
+}
+
+func pathUpdate(path string) update {
+	return update{event: watcher.Event{Path: path}}
+}
+
+func assertCalls(t *testing.T, r *recorder, calls []string, at []time.Duration) {
+	t.Helper()
+
+	if len(r.calls) != len(calls) {
+		t.Fatalf("expected calls %v at %v, got %v at %v", calls, at, r.calls, r.at)
+	}
+
+	for i := range calls {
+		if r.calls[i] != calls[i] || r.at[i] != at[i] {
+			t.Fatalf("expected calls %v at %v, got %v at %v", calls, at, r.calls, r.at)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	clk := newFakeClock()
+	r := &recorder{clk: clk}
+	l := audit(r.fn, 100*time.Millisecond, clk)
+
+	// Window starts by the first call & isn't extended by the next ones
+	_ = l.call(pathUpdate("a"))
+	clk.Advance(60 * time.Millisecond)
+	_ = l.call(pathUpdate("b"))
+	if !l.pending() {
+		t.Fatal("expected pending invocation")
+	}
+	clk.Advance(60 * time.Millisecond)
+	assertCalls(t, r, []string{"b"}, []time.Duration{100 * time.Millisecond})
+
+	// Nothing happens without calls
+	clk.Advance(time.Second)
+	if l.pending() {
+		t.Fatal("expected no pending invocation")
+	}
+	assertCalls(t, r, []string{"b"}, []time.Duration{100 * time.Millisecond})
+
+	// Next call starts a new window
+	_ = l.call(pathUpdate("c"))
+	clk.Advance(100 * time.Millisecond)
+	assertCalls(t, r, []string{"b", "c"}, []time.Duration{100 * time.Millisecond, 1220 * time.Millisecond})
+}
+
+func TestAuditFlush(t *testing.T) {
+	clk := newFakeClock()
+	r := &recorder{clk: clk}
+	l := audit(r.fn, 100*time.Millisecond, clk)
+
+	_ = l.call(pathUpdate("a"))
+	clk.Advance(10 * time.Millisecond)
+	l.flush()
+	assertCalls(t, r, []string{"a"}, []time.Duration{10 * time.Millisecond})
+
+	// Flushed window doesn't fire again
+	clk.Advance(time.Second)
+	assertCalls(t, r, []string{"a"}, []time.Duration{10 * time.Millisecond})
+}
+
+func TestSample(t *testing.T) {
+	clk := newFakeClock()
+	r := &recorder{clk: clk}
+	l := sample(r.fn, 100*time.Millisecond, clk)
+
+	_ = l.call(pathUpdate("a"))
+	clk.Advance(30 * time.Millisecond)
+	_ = l.call(pathUpdate("b"))
+	clk.Advance(70 * time.Millisecond)
+	assertCalls(t, r, []string{"b"}, []time.Duration{100 * time.Millisecond})
+
+	// Periods keep their phase while calls arrive
+	clk.Advance(50 * time.Millisecond)
+	_ = l.call(pathUpdate("c"))
+	clk.Advance(50 * time.Millisecond)
+	assertCalls(t, r, []string{"b", "c"}, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond})
+
+	// Periods without calls don't invoke
+	clk.Advance(time.Second)
+	if l.pending() {
+		t.Fatal("expected no pending invocation")
+	}
+	assertCalls(t, r, []string{"b", "c"}, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond})
+
+	// Sampling resumes by the next call
+	_ = l.call(pathUpdate("d"))
+	clk.Advance(100 * time.Millisecond)
+	assertCalls(t, r,
+		[]string{"b", "c", "d"},
+		[]time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 1300 * time.Millisecond},
+	)
+}
+
+func TestSampleFlush(t *testing.T) {
+	clk := newFakeClock()
+	r := &recorder{clk: clk}
+	l := sample(r.fn, 100*time.Millisecond, clk)
+
+	_ = l.call(pathUpdate("a"))
+	clk.Advance(10 * time.Millisecond)
+	l.flush()
+	assertCalls(t, r, []string{"a"}, []time.Duration{10 * time.Millisecond})
+
+	clk.Advance(time.Second)
+	assertCalls(t, r, []string{"a"}, []time.Duration{10 * time.Millisecond})
+}
+
+func TestTokenBucket(t *testing.T) {
+	clk := newFakeClock()
+	r := &recorder{clk: clk}
+	l := tokenBucket(r.fn, 2, 100*time.Millisecond, clk)
+
+	// Burst runs immediately
+	_ = l.call(pathUpdate("a"))
+	_ = l.call(pathUpdate("b"))
+	assertCalls(t, r, []string{"a", "b"}, []time.Duration{0, 0})
+
+	// Empty bucket holds the latest call until a token is added
+	_ = l.call(pathUpdate("c"))
+	clk.Advance(50 * time.Millisecond)
+	_ = l.call(pathUpdate("d"))
+	if !l.pending() {
+		t.Fatal("expected pending invocation")
+	}
+	clk.Advance(50 * time.Millisecond)
+	assertCalls(t, r, []string{"a", "b", "d"}, []time.Duration{0, 0, 100 * time.Millisecond})
+
+	// Steady rate afterwards
+	_ = l.call(pathUpdate("e"))
+	clk.Advance(100 * time.Millisecond)
+	assertCalls(t, r,
+		[]string{"a", "b", "d", "e"},
+		[]time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond},
+	)
+
+	// Bucket gets refilled up to its size while idle
+	clk.Advance(time.Second)
+	_ = l.call(pathUpdate("f"))
+	_ = l.call(pathUpdate("g"))
+	_ = l.call(pathUpdate("h"))
+	assertCalls(t, r,
+		[]string{"a", "b", "d", "e", "f", "g"},
+		[]time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond, 1200 * time.Millisecond, 1200 * time.Millisecond},
+	)
+	clk.Advance(100 * time.Millisecond)
+	assertCalls(t, r,
+		[]string{"a", "b", "d", "e", "f", "g", "h"},
+		[]time.Duration{
+			0, 0, 100 * time.Millisecond, 200 * time.Millisecond,
+			1200 * time.Millisecond, 1200 * time.Millisecond, 1300 * time.Millisecond,
+		},
+	)
+}
@@ -0,0 +1,111 @@
+package polywatch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pouyanh/polywatch/config"
+)
+
+// rule is a compiled config.Rule
+type rule struct {
+	cfg   config.Rule
+	label string
+	files ignoreList
+	// tpl is nil when the rule doesn't have anything to run before the restart
+	tpl *template.Template
+}
+
+func newRules(project string, rr []config.Rule) ([]rule, error) {
+	rules := make([]rule, len(rr))
+	for i, r := range rr {
+		rules[i] = rule{
+			cfg:   r,
+			label: r.Name,
+			files: parseIgnoreList(project, strings.NewReader(strings.Join(r.Files, "\n"))),
+		}
+
+		if r.Name == "" {
+			rules[i].label = fmt.Sprintf("#%d", i+1)
+		}
+
+		if r.Exec != "" {
+			tpl, err := config.ParseExec(r.Exec)
+			if err != nil {
+				return nil, err
+			}
+
+			rules[i].tpl = tpl
+		}
+	}
+
+	return rules, nil
+}
+
+// matches reports whether any of changed files is matched by the rule. Negated patterns exclude files just like
+// ignore files do
+func (r rule) matches(cs changeSet) bool {
+	for _, c := range cs {
+		path := c.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(r.files.base, path)
+		}
+
+		rel, err := filepath.Rel(r.files.base, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		if matched, yes := r.files.match(filepath.ToSlash(rel), c.IsDir); matched && yes {
+			return true
+		}
+	}
+
+	return false
+}
+
+// route returns the first rule matching the batch
+func (pw *polyWatcher) route(cs changeSet) (rule, bool) {
+	for _, r := range pw.rules {
+		if r.matches(cs) {
+			return r, true
+		}
+	}
+
+	return rule{}, false
+}
+
+// applyRule runs exec of the rule & reports whether the command has to get restarted afterwards
+func (pw *polyWatcher) applyRule(ctx context.Context, r rule, cs changeSet) (bool, error) {
+	pw.lg.Printf("rule %s matched\n", r.label)
+
+	if r.tpl == nil {
+		return r.cfg.Restart, nil
+	}
+
+	script, err := renderExec(r.tpl, newExecData(pw.cfg.Name, pw.runs, cs, pw.captures))
+	if err != nil {
+		return false, fmt.Errorf("unable to render exec of rule %s: %w", r.label, err)
+	}
+
+	env, list, err := cs.env(pw.cfg.Name, pw.cfg.Command.ChangedFilesList)
+	if err != nil {
+		pw.lg.Printf("unable to write list of changed files: %s\n", err)
+	}
+	if list != "" {
+		defer os.Remove(list)
+	}
+
+	cmd := pw.command(script)
+	cmd.Env = append(append([]string{}, pw.cfg.Command.Env...), env...)
+	pw.publish(runStarted, false)
+	if err := pw.runJob(ctx, cmd); err != nil {
+		return false, fmt.Errorf("exec of rule %s failed: %w", r.label, err)
+	}
+
+	return r.cfg.Restart, nil
+}
@@ -0,0 +1,87 @@
+package polywatch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+// mtimeSlack covers modification times which are taken from the coarse clock of the kernel, so they may fall a few
+// milliseconds behind the actual time of writes
+const mtimeSlack = 20 * time.Millisecond
+
+// writeWindow is the period of a run. End is zero while it's in progress
+type writeWindow struct {
+	start, end time.Time
+}
+
+// writeTracker remembers runs of the command, so events of files modified while any of them is in progress don't
+// re-trigger it. Modification times are compared rather than observing the process tree, so writes which take just
+// microseconds don't get missed. Anything else modified during runs gets ignored too
+type writeTracker struct {
+	// grace keeps the window open after a run ends, until the polling watcher catches up
+	grace time.Duration
+
+	mu      sync.Mutex
+	windows []*writeWindow
+}
+
+func newWriteTracker(grace time.Duration) *writeTracker {
+	return &writeTracker{
+		grace: grace,
+	}
+}
+
+// track opens a window for a run starting now. It has to get closed using the returned function once the run exits
+func (wt *writeTracker) track() func() {
+	w := &writeWindow{start: time.Now().Add(-mtimeSlack)}
+
+	wt.mu.Lock()
+	wt.windows = append(wt.windows, w)
+	wt.mu.Unlock()
+
+	return func() {
+		wt.mu.Lock()
+		defer wt.mu.Unlock()
+
+		w.end = time.Now()
+	}
+}
+
+// wrote reports whether a change happened at t while a run was in progress or during grace period of its end
+func (wt *writeTracker) wrote(t time.Time) bool {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+
+	now := time.Now()
+	found := false
+	windows := wt.windows[:0]
+	for _, w := range wt.windows {
+		if !w.end.IsZero() && now.Sub(w.end) > wt.grace {
+			// Expired
+			continue
+		}
+		windows = append(windows, w)
+
+		if !t.Before(w.start) && (w.end.IsZero() || !t.After(w.end.Add(wt.grace))) {
+			found = true
+		}
+	}
+	wt.windows = windows
+
+	return found
+}
+
+// eventTime returns when the change of e happened. Just creations & writes carry it as the modification time, others
+// are caught by the polling watcher within the grace period
+func eventTime(e watcher.Event) time.Time {
+	switch e.Op {
+	case watcher.Create, watcher.Write:
+		if e.FileInfo != nil {
+			return e.ModTime()
+		}
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,82 @@
+package polywatch
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func modTime(t *testing.T, path string) time.Time {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return info.ModTime()
+}
+
+func TestWriteTrackerShortWrites(t *testing.T) {
+	dir := t.TempDir()
+	grace := 100 * time.Millisecond
+	wt := newWriteTracker(grace)
+
+	before := filepath.Join(dir, "before.txt")
+	if err := os.WriteFile(before, []byte("user"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * mtimeSlack)
+
+	// Generator which opens, writes & closes each file in no time & exits
+	untrack := wt.track()
+	script := fmt.Sprintf(`for i in 1 2 3 4 5; do echo "package gen" > %s/gen$i.go; done`, dir)
+	if out, err := exec.Command("/bin/sh", "-c", script).CombinedOutput(); err != nil {
+		t.Fatalf("generator failed: %s: %s", err, out)
+	}
+	untrack()
+
+	for i := 1; i <= 5; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("gen%d.go", i))
+		if !wt.wrote(modTime(t, path)) {
+			t.Errorf("expected %s to be written by the command", path)
+		}
+	}
+
+	if !wt.wrote(modTime(t, dir)) {
+		t.Errorf("expected directory of generated files to be written by the command")
+	}
+
+	if wt.wrote(modTime(t, before)) {
+		t.Errorf("expected %s written before the run not to be ignored", before)
+	}
+
+	time.Sleep(2 * grace)
+
+	after := filepath.Join(dir, "after.txt")
+	if err := os.WriteFile(after, []byte("user"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if wt.wrote(modTime(t, after)) {
+		t.Errorf("expected %s written after the run not to be ignored", after)
+	}
+}
+
+func TestWriteTrackerRunInProgress(t *testing.T) {
+	wt := newWriteTracker(0)
+
+	untrack := wt.track()
+	if !wt.wrote(time.Now()) {
+		t.Errorf("expected changes during a run to be ignored")
+	}
+
+	untrack()
+	time.Sleep(10 * time.Millisecond)
+	if wt.wrote(time.Now()) {
+		t.Errorf("expected changes after the run to be handled")
+	}
+}
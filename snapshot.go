@@ -0,0 +1,183 @@
+package polywatch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+// fileState is what gets persisted about each watched file
+type fileState struct {
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	Hash    string      `json:"hash,omitempty"`
+}
+
+// changed compares contents when both states have been hashed, otherwise relies on size & modification time
+func (fs fileState) changed(cur fileState) bool {
+	if fs.Size != cur.Size {
+		return true
+	}
+
+	if fs.Hash != "" && cur.Hash != "" {
+		return fs.Hash != cur.Hash
+	}
+
+	return !fs.ModTime.Equal(cur.ModTime)
+}
+
+type snapshot map[string]fileState
+
+// stateFile holds snapshots of all watchers keyed by their names
+type stateFile struct {
+	Watchers map[string]snapshot `json:"watchers"`
+}
+
+// stateMu serializes accesses of watchers sharing the same state file
+var stateMu sync.Mutex
+
+func takeSnapshot(files map[string]os.FileInfo, hash bool) snapshot {
+	snap := make(snapshot, len(files))
+	for path, info := range files {
+		fs := fileState{
+			Size:    info.Size(),
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+		}
+
+		if hash && info.Mode().IsRegular() {
+			fs.Hash = hashFile(path)
+		}
+
+		snap[path] = fs
+	}
+
+	return snap
+}
+
+func hashFile(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func readStateFile(file string) (stateFile, error) {
+	sf := stateFile{Watchers: make(map[string]snapshot)}
+
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sf, nil
+		}
+
+		return sf, err
+	}
+
+	if err := json.Unmarshal(raw, &sf); err != nil {
+		return sf, err
+	}
+
+	if sf.Watchers == nil {
+		sf.Watchers = make(map[string]snapshot)
+	}
+
+	return sf, nil
+}
+
+// loadSnapshot returns persisted snapshot of the watcher, or nil if there is none
+func loadSnapshot(file, name string) (snapshot, error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	sf, err := readStateFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return sf.Watchers[name], nil
+}
+
+func saveSnapshot(file, name string, snap snapshot) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	sf, err := readStateFile(file)
+	if err != nil {
+		return err
+	}
+
+	sf.Watchers[name] = snap
+
+	raw, err := json.MarshalIndent(sf, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write & rename in order not to leave a corrupted file behind
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
+
+// diff returns events which turn prev snapshot into the current one
+func (snap snapshot) diff(prev snapshot, files map[string]os.FileInfo) []watcher.Event {
+	var ee []watcher.Event
+	for path, cur := range snap {
+		old, found := prev[path]
+		switch {
+		case !found:
+			ee = append(ee, watcher.Event{Op: watcher.Create, Path: path, FileInfo: files[path]})
+
+		// Directory modification times change along with their entries which are reported themselves
+		case !cur.Mode.IsDir() && old.changed(cur):
+			ee = append(ee, watcher.Event{Op: watcher.Write, Path: path, OldPath: path, FileInfo: files[path]})
+
+		case old.Mode != cur.Mode:
+			ee = append(ee, watcher.Event{Op: watcher.Chmod, Path: path, OldPath: path, FileInfo: files[path]})
+		}
+	}
+
+	for path, old := range prev {
+		if _, found := snap[path]; found {
+			continue
+		}
+
+		ee = append(ee, watcher.Event{
+			Op:      watcher.Remove,
+			Path:    path,
+			OldPath: path,
+			FileInfo: fileInfo{
+				name:    filepath.Base(path),
+				size:    old.Size,
+				mode:    old.Mode,
+				modTime: old.ModTime,
+				dir:     old.Mode.IsDir(),
+			},
+		})
+	}
+
+	sort.Slice(ee, func(i, j int) bool { return ee[i].Path < ee[j].Path })
+
+	return ee
+}
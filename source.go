@@ -0,0 +1,211 @@
+package polywatch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+// commandSource keeps a watcher in sync with the list of paths printed by a command
+type commandSource struct {
+	shell   string
+	env     []string
+	command string
+	refresh time.Duration
+
+	w  *watcher.Watcher
+	im *ignoreMatcher
+	lg *log.Logger
+
+	chRefresh chan struct{}
+
+	mu      sync.Mutex
+	paths   map[string]os.FileInfo
+	missing map[string]bool
+}
+
+func newCommandSource(shell string, env []string, command string, refresh time.Duration, w *watcher.Watcher, im *ignoreMatcher, lg *log.Logger) *commandSource {
+	return &commandSource{
+		shell:   shell,
+		env:     env,
+		command: command,
+		refresh: refresh,
+
+		w:  w,
+		im: im,
+		lg: lg,
+
+		chRefresh: make(chan struct{}, 1),
+
+		paths:   make(map[string]os.FileInfo),
+		missing: make(map[string]bool),
+	}
+}
+
+// load runs the command & replaces watched paths by the ones it prints. It returns events of listed paths which have
+// been created or removed since previous load
+func (cs *commandSource) load() ([]watcher.Event, error) {
+	cmd := shellCommand(cs.shell, cs.command)
+	cmd.Env = cs.env
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list files using %q: %w", cs.command, err)
+	}
+
+	listed := make(map[string]bool)
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+
+		path, err := filepath.Abs(line)
+		if err != nil {
+			return nil, err
+		}
+
+		listed[path] = true
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	var ee []watcher.Event
+	for path, info := range cs.paths {
+		_, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			ee = append(ee, watcher.Event{Op: watcher.Remove, Path: path, OldPath: path, FileInfo: info})
+		}
+
+		if !listed[path] || err != nil {
+			_ = cs.w.Remove(path)
+			delete(cs.paths, path)
+		}
+	}
+
+	missing := make(map[string]bool)
+	for path := range listed {
+		if _, ok := cs.paths[path]; ok {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err == nil {
+			if info.IsDir() {
+				// Listed directories are watched without their subdirectories
+				cs.im.addNonRecursive(path)
+			}
+
+			err = cs.w.Add(path)
+		}
+		if err != nil {
+			if os.IsNotExist(err) {
+				missing[path] = true
+				continue
+			}
+
+			return nil, err
+		}
+
+		if cs.missing[path] {
+			ee = append(ee, watcher.Event{Op: watcher.Create, Path: path, FileInfo: info})
+		}
+		cs.paths[path] = info
+	}
+	cs.missing = missing
+
+	return ee, nil
+}
+
+// owns reports whether path is one of the listed paths
+func (cs *commandSource) owns(path string) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	_, ok := cs.paths[path]
+
+	return ok || cs.missing[path]
+}
+
+// stale reports whether any listed path has been created or removed since last load
+func (cs *commandSource) stale() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for path := range cs.paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return true
+		}
+	}
+
+	for path := range cs.missing {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requestRefresh schedules a reload without blocking
+func (cs *commandSource) requestRefresh() {
+	select {
+	case cs.chRefresh <- struct{}{}:
+	default:
+	}
+}
+
+// run reloads paths periodically, on request or whenever a listed path gets created or removed. Creation & removal
+// events are delivered through watcher's event channel, so it must not be called from the event loop
+func (cs *commandSource) run(ctx context.Context, interval time.Duration) {
+	var chTick <-chan time.Time
+	if cs.refresh > 0 {
+		t := time.NewTicker(cs.refresh)
+		defer t.Stop()
+
+		chTick = t.C
+	}
+
+	check := time.NewTicker(interval)
+	defer check.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-check.C:
+			if !cs.stale() {
+				continue
+			}
+
+		case <-chTick:
+		case <-cs.chRefresh:
+		}
+
+		ee, err := cs.load()
+		if err != nil {
+			cs.lg.Printf("unable to refresh watched files: %s\n", err)
+		}
+
+		for _, e := range ee {
+			select {
+			case cs.w.Event <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
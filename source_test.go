@@ -0,0 +1,44 @@
+package polywatch
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/radovskyb/watcher"
+)
+
+func TestCommandSourceSkipsIgnoredSubdirectories(t *testing.T) {
+	project := t.TempDir()
+	dir := filepath.Join(project, "d")
+	if err := os.MkdirAll(filepath.Join(dir, "node_modules"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		".gitignore": "node_modules/\n",
+		"d/a.go":     "package d\n",
+	} {
+		if err := os.WriteFile(filepath.Join(project, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := watcher.New()
+	im := newIgnoreMatcher(project, []string{".gitignore"}, nil)
+	w.AddFilterHook(im.hook())
+
+	cs := newCommandSource("/bin/sh -c", os.Environ(), "echo '"+dir+"'", 0, w, im, log.New(io.Discard, "", 0))
+	if _, err := cs.load(); err != nil {
+		t.Fatalf("unable to load listed directory: %s", err)
+	}
+
+	watched := w.WatchedFiles()
+	if _, ok := watched[filepath.Join(dir, "a.go")]; !ok {
+		t.Errorf("expected %s to be watched", filepath.Join(dir, "a.go"))
+	}
+	if _, ok := watched[filepath.Join(dir, "node_modules")]; ok {
+		t.Errorf("expected %s to be ignored", filepath.Join(dir, "node_modules"))
+	}
+}
@@ -0,0 +1,164 @@
+package polywatch
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pouyanh/polywatch/config"
+)
+
+// maxTail is the amount of latest output of the command which is kept in order to be shown on crash loops
+const maxTail = 4 * 1024
+
+// supervisor restarts the command when it exits on its own, delaying restarts exponentially. Once restarts within the
+// window exceed the limit the command is considered to be in a crash loop & isn't restarted until reset
+type supervisor struct {
+	cfg config.Command
+
+	mu       sync.Mutex
+	restarts []time.Time
+}
+
+func newSupervisor(cfg config.Command) *supervisor {
+	return &supervisor{
+		cfg: cfg,
+	}
+}
+
+// wants reports whether the command has to get restarted according to its exit error
+func (s *supervisor) wants(err error) bool {
+	switch s.cfg.Restart {
+	case config.RestartAlways:
+		return true
+	case config.RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+// next records a restart at now & returns its delay. It reports false when the command is in a crash loop
+func (s *supervisor) next(now time.Time) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recent := s.restarts[:0]
+	for _, t := range s.restarts {
+		if now.Sub(t) < s.cfg.RestartWindow {
+			recent = append(recent, t)
+		}
+	}
+	s.restarts = recent
+
+	if len(s.restarts) >= s.cfg.MaxRestarts {
+		return 0, false
+	}
+
+	delay := s.cfg.RestartBackoff
+	for i := 0; i < len(s.restarts) && delay < s.cfg.RestartMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.cfg.RestartMaxBackoff {
+		delay = s.cfg.RestartMaxBackoff
+	}
+
+	s.restarts = append(s.restarts, now)
+
+	return delay, true
+}
+
+func (s *supervisor) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.restarts = nil
+}
+
+// restart starts p again after the backoff delay unless it's replaced by a change or the watcher is stopped meanwhile
+func (pw *polyWatcher) restart(ctx context.Context, p *process) {
+	delay, ok := pw.sup.next(time.Now())
+	if !ok {
+		pw.lg.Printf("crash loop: command exited more than %d time(s) within %s, last by %s; waiting for a change\n",
+			pw.cfg.Command.MaxRestarts, pw.cfg.Command.RestartWindow, p.ProcessState)
+		if tail := p.tail.String(); tail != "" {
+			pw.lg.Printf("last output of the command:\n%s", tail)
+		}
+
+		return
+	}
+
+	pw.lg.Printf("restarting command in %s\n", delay)
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(delay):
+	}
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	if pw.proc != p || ctx.Err() != nil {
+		return
+	}
+
+	if err := pw.start(ctx, p.respawn); err != nil {
+		pw.lg.Printf("unable to restart command: %s\n", err)
+	}
+}
+
+// cloneCommand returns an unstarted copy of cmd since commands can't be started more than once
+func cloneCommand(cmd *exec.Cmd) *exec.Cmd {
+	clone := exec.Command(cmd.Path)
+	clone.Args = cmd.Args
+	clone.Env = cmd.Env
+	clone.Dir = cmd.Dir
+	clone.SysProcAttr = cmd.SysProcAttr
+	clone.Stdin = cmd.Stdin
+	clone.Stdout = cmd.Stdout
+	clone.Stderr = cmd.Stderr
+
+	return clone
+}
+
+// tailBuffer keeps the latest max bytes written into it
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func newTailBuffer(max int) *tailBuffer {
+	return &tailBuffer{
+		max: max,
+	}
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.max:]...)
+	}
+
+	return len(p), nil
+}
+
+// String returns the kept output starting from its first whole line
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := t.buf
+	if len(out) == t.max {
+		if i := bytes.IndexByte(out, '\n'); i >= 0 {
+			out = out[i+1:]
+		}
+	}
+
+	return string(out)
+}
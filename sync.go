@@ -0,0 +1,395 @@
+package polywatch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/radovskyb/watcher"
+
+	"github.com/pouyanh/polywatch/config"
+)
+
+// syncer mirrors files of a source directory into a destination one
+type syncer struct {
+	cfg      config.Action
+	src, dst string
+
+	// fileMode & dirMode are zero when permissions are preserved
+	fileMode os.FileMode
+	dirMode  os.FileMode
+	// uid & gid are -1 when they're not changed
+	uid, gid int
+
+	hooks []watcher.FilterFileHookFunc
+
+	copied, removed, skipped int
+}
+
+// sync mirrors changed files of the batch. Batches without any changed file, like the one on start, mirror the whole
+// source which is walked just like the watcher does
+func (pw *polyWatcher) sync(a config.Action, cs changeSet) (string, error) {
+	s, err := newSyncer(a, pw.hooks)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(s.dst, 0o755); err != nil {
+		return "", err
+	}
+
+	if len(cs) == 0 {
+		err = s.all()
+	} else {
+		err = s.changes(cs)
+	}
+
+	return fmt.Sprintf("%d copied, %d removed & %d skipped", s.copied, s.removed, s.skipped), err
+}
+
+func newSyncer(a config.Action, hooks []watcher.FilterFileHookFunc) (*syncer, error) {
+	src, err := filepath.Abs(os.ExpandEnv(a.Source))
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := filepath.Abs(os.ExpandEnv(a.Destination))
+	if err != nil {
+		return nil, err
+	}
+
+	if rel, err := filepath.Rel(dst, src); err == nil && !strings.HasPrefix(rel, "..") {
+		return nil, errors.New("destination can't contain source")
+	}
+
+	// Already validated on load
+	fileMode, _ := config.ParseMode(a.FileMode)
+	dirMode, _ := config.ParseMode(a.DirMode)
+
+	uid, gid, err := lookupOwner(a.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syncer{
+		cfg: a,
+		src: src,
+		dst: dst,
+
+		fileMode: os.FileMode(fileMode),
+		dirMode:  os.FileMode(dirMode),
+		uid:      uid,
+		gid:      gid,
+
+		hooks: hooks,
+	}, nil
+}
+
+// lookupOwner resolves user[:group] either by names or ids
+func lookupOwner(owner string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if owner == "" {
+		return
+	}
+
+	name, group, _ := strings.Cut(owner, ":")
+	if name != "" {
+		if uid, err = strconv.Atoi(name); err != nil {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return -1, -1, err
+			}
+
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return -1, -1, err
+			}
+
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+
+	return uid, gid, nil
+}
+
+func (s *syncer) rel(path string) (string, bool) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(s.src, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+
+	// Destination may be inside source, while its files mustn't be mirrored into itself
+	if d, err := filepath.Rel(s.dst, path); err == nil && !strings.HasPrefix(d, "..") {
+		return "", false
+	}
+
+	return rel, true
+}
+
+func (s *syncer) changes(cs changeSet) error {
+	for _, c := range cs {
+		if c.OldPath != "" && s.cfg.Delete {
+			if rel, ok := s.rel(c.OldPath); ok {
+				if err := s.remove(rel); err != nil {
+					return err
+				}
+			}
+		}
+
+		rel, ok := s.rel(c.Path)
+		if !ok {
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(s.src, rel))
+		if errors.Is(err, fs.ErrNotExist) || c.Op == watcher.Remove {
+			if s.cfg.Delete {
+				if err := s.remove(rel); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := s.copy(rel, info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// all mirrors the whole source & removes files of destination which don't exist in source anymore if delete is set
+func (s *syncer) all() error {
+	synced := map[string]bool{".": true}
+	err := filepath.Walk(s.src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == s.src {
+			return nil
+		}
+
+		if path == s.dst {
+			// Destination is inside source
+			return filepath.SkipDir
+		}
+
+		for _, h := range s.hooks {
+			err := h(info, path)
+			if errors.Is(err, watcher.ErrSkip) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		rel, _ := s.rel(path)
+		for dir := rel; dir != "."; dir = filepath.Dir(dir) {
+			synced[dir] = true
+		}
+
+		return s.copy(rel, info)
+	})
+	if err != nil || !s.cfg.Delete {
+		return err
+	}
+
+	return filepath.Walk(s.dst, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+
+			return err
+		}
+
+		rel, err := filepath.Rel(s.dst, path)
+		if err != nil || synced[rel] {
+			return err
+		}
+
+		if err := s.remove(rel); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+}
+
+func (s *syncer) copy(rel string, info os.FileInfo) error {
+	if err := s.mkdirParents(rel); err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return s.mkdir(rel, info)
+	}
+
+	src, dst := filepath.Join(s.src, rel), filepath.Join(s.dst, rel)
+	if s.same(src, info, dst) {
+		s.skipped++
+		return nil
+	}
+
+	if err := s.copyFile(src, info, dst); err != nil {
+		return err
+	}
+	s.copied++
+
+	return nil
+}
+
+// same reports whether dst is identical to src using checksums or size & modification time
+func (s *syncer) same(src string, info os.FileInfo, dst string) bool {
+	stat, err := os.Stat(dst)
+	if err != nil || !stat.Mode().IsRegular() || stat.Size() != info.Size() {
+		return false
+	}
+
+	if s.cfg.Checksum {
+		sum := hashFile(src)
+
+		return sum != "" && sum == hashFile(dst)
+	}
+
+	return stat.ModTime().Equal(info.ModTime())
+}
+
+// copyFile replaces dst atomically, so the destination never contains a partially written file
+func (s *syncer) copyFile(src string, info os.FileInfo, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".pw-sync-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		_ = tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := s.apply(tmp.Name(), info, s.fileMode); err != nil {
+		return err
+	}
+
+	if err := os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+
+	if stat, err := os.Lstat(dst); err == nil && stat.IsDir() {
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (s *syncer) mkdir(rel string, info os.FileInfo) error {
+	dst := filepath.Join(s.dst, rel)
+	if stat, err := os.Lstat(dst); err == nil && !stat.IsDir() {
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Mkdir(dst, 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	return s.apply(dst, info, s.dirMode)
+}
+
+// mkdirParents creates missing parent directories of rel having permissions of their source counterparts
+func (s *syncer) mkdirParents(rel string) error {
+	var missing []string
+	for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(s.dst, dir)); err == nil {
+			break
+		}
+
+		missing = append(missing, dir)
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		info, err := os.Stat(filepath.Join(s.src, missing[i]))
+		if err != nil {
+			return err
+		}
+
+		if err := s.mkdir(missing[i], info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apply sets permissions & owner of path according to mappings
+func (s *syncer) apply(path string, info os.FileInfo, mode os.FileMode) error {
+	if mode == 0 {
+		mode = info.Mode().Perm()
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+
+	if s.uid == -1 && s.gid == -1 {
+		return nil
+	}
+
+	return os.Lchown(path, s.uid, s.gid)
+}
+
+func (s *syncer) remove(rel string) error {
+	path := filepath.Join(s.dst, rel)
+	if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	s.removed++
+
+	return nil
+}
@@ -0,0 +1,310 @@
+package polywatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+
+	"github.com/pouyanh/polywatch/config"
+)
+
+func writeFile(t *testing.T, path, content string, mtime time.Time) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+
+	return err == nil
+}
+
+// newTestSyncer creates destination just like sync does before mirroring
+func newTestSyncer(t *testing.T, a config.Action) *syncer {
+	t.Helper()
+
+	s, err := newSyncer(a, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(s.dst, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestSyncerCopy(t *testing.T) {
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		checksum bool
+		// dst is the content of destination file which is missing when empty, & dstTime is its modification time
+		dst     string
+		dstTime time.Time
+		copied  bool
+	}{
+		{"missing destination", false, "", time.Time{}, true},
+		{"same size & mtime", false, "bbb", mtime, false},
+		{"same size & different mtime", false, "aaa", mtime.Add(time.Second), true},
+		{"different size", false, "aaaa", mtime, true},
+		{"checksum of same content", true, "aaa", mtime.Add(time.Second), false},
+		{"checksum of different content", true, "bbb", mtime, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+			writeFile(t, filepath.Join(src, "a.txt"), "aaa", mtime)
+			if tt.dst != "" {
+				writeFile(t, filepath.Join(dst, "a.txt"), tt.dst, tt.dstTime)
+			}
+
+			s := newTestSyncer(t, config.Action{Source: src, Destination: dst, Checksum: tt.checksum})
+			if err := s.changes(changeSet{{Path: filepath.Join(src, "a.txt"), Op: watcher.Write}}); err != nil {
+				t.Fatal(err)
+			}
+
+			if copied := s.copied == 1; copied != tt.copied {
+				t.Fatalf("expected copied %v, got %d copied & %d skipped", tt.copied, s.copied, s.skipped)
+			}
+
+			want := tt.dst
+			if tt.copied {
+				want = "aaa"
+			}
+			if got := readFile(t, filepath.Join(dst, "a.txt")); got != want {
+				t.Errorf("expected destination content %q, got %q", want, got)
+			}
+
+			if tt.copied {
+				stat, err := os.Stat(filepath.Join(dst, "a.txt"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !stat.ModTime().Equal(mtime) {
+					t.Errorf("expected modification time %s to be preserved, got %s", mtime, stat.ModTime())
+				}
+			}
+		})
+	}
+}
+
+func TestSyncerDelete(t *testing.T) {
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name   string
+		delete bool
+		// src & dst are files of source & destination before the sync
+		src []string
+		dst []string
+		// change is the changed file & old is its previous path, both relative to source. No change means whole sync
+		change string
+		op     watcher.Op
+		old    string
+		want   []string
+		absent []string
+	}{
+		{
+			name: "removed", delete: true,
+			dst:    []string{"a.txt", "b.txt"},
+			change: "a.txt", op: watcher.Remove,
+			want: []string{"b.txt"}, absent: []string{"a.txt"},
+		},
+		{
+			name: "removed without delete", delete: false,
+			dst:    []string{"a.txt"},
+			change: "a.txt", op: watcher.Remove,
+			want: []string{"a.txt"},
+		},
+		{
+			name: "removed directory", delete: true,
+			dst:    []string{"dir/a.txt", "b.txt"},
+			change: "dir", op: watcher.Remove,
+			want: []string{"b.txt"}, absent: []string{"dir"},
+		},
+		{
+			name: "renamed", delete: true,
+			src: []string{"new.txt"}, dst: []string{"old.txt"},
+			change: "new.txt", op: watcher.Rename, old: "old.txt",
+			want: []string{"new.txt"}, absent: []string{"old.txt"},
+		},
+		{
+			name: "renamed without delete", delete: false,
+			src: []string{"new.txt"}, dst: []string{"old.txt"},
+			change: "new.txt", op: watcher.Rename, old: "old.txt",
+			want: []string{"new.txt", "old.txt"},
+		},
+		{
+			name: "moved out of source", delete: true,
+			dst:    []string{"old.txt"},
+			change: "../elsewhere.txt", op: watcher.Move, old: "old.txt",
+			absent: []string{"old.txt", "../elsewhere.txt"},
+		},
+		{
+			name: "whole sync", delete: true,
+			src: []string{"a.txt", "dir/b.txt"}, dst: []string{"stale.txt", "dir/stale.txt", "gone/c.txt"},
+			want:   []string{"a.txt", "dir/b.txt"},
+			absent: []string{"stale.txt", "dir/stale.txt", "gone"},
+		},
+		{
+			name: "whole sync without delete", delete: false,
+			src: []string{"a.txt"}, dst: []string{"stale.txt"},
+			want: []string{"a.txt", "stale.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+			if err := os.MkdirAll(src, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range tt.src {
+				writeFile(t, filepath.Join(src, f), f, mtime)
+			}
+			for _, f := range tt.dst {
+				writeFile(t, filepath.Join(dst, f), f, mtime)
+			}
+
+			s := newTestSyncer(t, config.Action{Source: src, Destination: dst, Delete: tt.delete})
+
+			var err error
+			if tt.change == "" {
+				err = s.all()
+			} else {
+				c := change{Path: filepath.Join(src, tt.change), Op: tt.op}
+				if tt.old != "" {
+					c.OldPath = filepath.Join(src, tt.old)
+				}
+				err = s.changes(changeSet{c})
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, f := range tt.want {
+				if !exists(filepath.Join(dst, f)) {
+					t.Errorf("expected %s to exist in destination", f)
+				}
+			}
+			for _, f := range tt.absent {
+				if exists(filepath.Join(dst, f)) {
+					t.Errorf("expected %s to be absent in destination", f)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncerModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileMode string
+		dirMode  string
+		wantFile os.FileMode
+		wantDir  os.FileMode
+	}{
+		{"preserved", "", "", 0o640, 0o750},
+		{"mapped", "0600", "0700", 0o600, 0o700},
+		{"file mode only", "0604", "", 0o604, 0o750},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+			writeFile(t, filepath.Join(src, "dir", "a.txt"), "a", time.Now())
+			if err := os.Chmod(filepath.Join(src, "dir", "a.txt"), 0o640); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(filepath.Join(src, "dir"), 0o750); err != nil {
+				t.Fatal(err)
+			}
+
+			a := config.Action{Source: src, Destination: dst, FileMode: tt.fileMode, DirMode: tt.dirMode}
+			s := newTestSyncer(t, a)
+			// Parent directory is created while copying the file
+			if err := s.changes(changeSet{{Path: filepath.Join(src, "dir", "a.txt"), Op: watcher.Create}}); err != nil {
+				t.Fatal(err)
+			}
+
+			for path, want := range map[string]os.FileMode{
+				filepath.Join(dst, "dir"):          tt.wantDir,
+				filepath.Join(dst, "dir", "a.txt"): tt.wantFile,
+			} {
+				stat, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := stat.Mode().Perm(); got != want {
+					t.Errorf("%s: expected mode %o, got %o", path, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncerDestinationInsideSource(t *testing.T) {
+	src := t.TempDir()
+	dst := filepath.Join(src, "out")
+	writeFile(t, filepath.Join(src, "a.txt"), "a", time.Now())
+
+	s := newTestSyncer(t, config.Action{Source: src, Destination: dst, Delete: true})
+
+	// Second sync shouldn't mirror or remove what the first one has written
+	for i := 0; i < 2; i++ {
+		if err := s.all(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := readFile(t, filepath.Join(dst, "a.txt")); got != "a" {
+		t.Errorf("expected a.txt to be mirrored, got %q", got)
+	}
+	if exists(filepath.Join(dst, "out")) {
+		t.Error("expected destination not to be mirrored into itself")
+	}
+
+	// Changes inside destination aren't mirrored either
+	if err := s.changes(changeSet{{Path: filepath.Join(dst, "a.txt"), Op: watcher.Write}}); err != nil {
+		t.Fatal(err)
+	}
+	if exists(filepath.Join(dst, "out")) {
+		t.Error("expected changes of destination not to be mirrored")
+	}
+}
+
+func TestSyncerSourceInsideDestination(t *testing.T) {
+	dst := t.TempDir()
+	for _, src := range []string{dst, filepath.Join(dst, "src"), filepath.Join(dst, "a", "b")} {
+		if _, err := newSyncer(config.Action{Source: src, Destination: dst}, nil); err == nil {
+			t.Errorf("expected source %s inside destination %s to be rejected", src, dst)
+		}
+	}
+}
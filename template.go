@@ -0,0 +1,69 @@
+package polywatch
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pouyanh/polywatch/config"
+)
+
+type (
+	execChange = config.ExecChange
+	execData   = config.ExecData
+)
+
+func newExecData(name string, run int, cs changeSet, captures []*regexp.Regexp) execData {
+	data := execData{
+		Watcher: name,
+		Run:     run,
+		Files:   cs.paths(),
+		Ops:     cs.ops(),
+		Changes: make([]execChange, len(cs)),
+	}
+
+	for i, c := range cs {
+		ec := execChange{
+			Path:   c.Path,
+			Dir:    filepath.Dir(c.Path),
+			Op:     c.Op.String(),
+			Groups: make(map[string]string),
+		}
+
+		filename := filepath.Base(c.Path)
+		for _, r := range captures {
+			m := r.FindStringSubmatch(filename)
+			if m == nil {
+				continue
+			}
+
+			ec.Match = m
+			for j, name := range r.SubexpNames() {
+				if name != "" {
+					ec.Groups[name] = m[j]
+				}
+			}
+			break
+		}
+
+		data.Changes[i] = ec
+	}
+
+	if len(data.Changes) > 0 {
+		data.ExecChange = data.Changes[0]
+	} else {
+		data.Groups = make(map[string]string)
+	}
+
+	return data
+}
+
+func renderExec(tpl *template.Template, data execData) (string, error) {
+	var sb strings.Builder
+	if err := tpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
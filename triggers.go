@@ -0,0 +1,131 @@
+package polywatch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/radovskyb/watcher"
+	"github.com/robfig/cron/v3"
+)
+
+// trigger feeds a synthetic event into the watcher, so it gets handled just like file events
+func (pw *polyWatcher) trigger(ctx context.Context, e watcher.Event) bool {
+	select {
+	case pw.w.Event <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// schedule starts scheduled triggers & returns a function which stops them
+func (pw *polyWatcher) schedule(ctx context.Context) func() {
+	if len(pw.cfg.Triggers.Schedule) == 0 {
+		return func() {}
+	}
+
+	c := cron.New()
+	for _, sch := range pw.cfg.Triggers.Schedule {
+		var (
+			s      cron.Schedule
+			reason string
+		)
+
+		if sch.Cron != "" {
+			// Already validated on load
+			s, _ = cron.ParseStandard(sch.Cron)
+			reason = fmt.Sprintf("schedule %q", sch.Cron)
+		} else {
+			s = cron.Every(sch.Every)
+			reason = fmt.Sprintf("schedule every %s", sch.Every)
+		}
+
+		c.Schedule(s, cron.FuncJob(func() {
+			pw.lg.Printf("triggered by %s\n", reason)
+			pw.trigger(ctx, triggerEvent(reason))
+		}))
+	}
+	c.Start()
+
+	return func() {
+		c.Stop()
+	}
+}
+
+// bindTriggerSignals triggers all of watchers on SIGUSR1 & the ones named in file on SIGUSR2
+func bindTriggerSignals(ctx context.Context, watchers []*polyWatcher, file string) {
+	lg := log.New(os.Stderr, "polywatch: ", log.LstdFlags)
+
+	ntfy := make(chan os.Signal, 1)
+	signal.Notify(ntfy, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		defer signal.Stop(ntfy)
+
+		for {
+			var sig os.Signal
+			select {
+			case sig = <-ntfy:
+			case <-ctx.Done():
+				return
+			}
+
+			targets := watchers
+			if sig == syscall.SIGUSR2 {
+				names, err := readTriggerFile(file)
+				if err != nil {
+					lg.Printf("unable to read trigger file: %s\n", err)
+					continue
+				}
+
+				targets = nil
+				for _, name := range names {
+					found := false
+					for _, w := range watchers {
+						if w.cfg.Name == name {
+							targets = append(targets, w)
+							found = true
+						}
+					}
+
+					if !found {
+						lg.Printf("unknown watcher %q in trigger file\n", name)
+					}
+				}
+			}
+
+			for _, w := range targets {
+				w.lg.Printf("triggered by %s\n", sig)
+				go w.trigger(ctx, triggerEvent(sig.String()))
+			}
+		}
+	}()
+}
+
+// readTriggerFile returns names of watchers listed in file, ignoring blank lines & comments
+func readTriggerFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		name := strings.TrimSpace(s.Text())
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	return names, s.Err()
+}
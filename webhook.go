@@ -0,0 +1,213 @@
+package polywatch
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/radovskyb/watcher"
+
+	"github.com/pouyanh/polywatch/config"
+)
+
+// maxWebhookBody bounds size of request bodies which list paths
+const maxWebhookBody = 1 << 20
+
+// webhook serves POST /watchers/{name}/trigger which fires the named watcher. Body may be a JSON array of paths,
+// relative to the working directory, which get handled as changed files
+type webhook struct {
+	token    string
+	watchers map[string]*polyWatcher
+	ctx      context.Context
+	lg       *log.Logger
+}
+
+// serveWebhook starts the listener in background. It gets stopped once ctx is done
+func serveWebhook(ctx context.Context, cfg config.Webhook, watchers map[string]*polyWatcher) error {
+	network, address := "tcp", cfg.Address
+	if strings.HasPrefix(address, "unix:") {
+		network, address = "unix", strings.TrimPrefix(address, "unix:")
+
+		// Clean up the socket left by a previous crash, unless another instance is still listening on it
+		if fi, err := os.Stat(address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			conn, err := net.DialTimeout(network, address, time.Second)
+			if err == nil {
+				_ = conn.Close()
+
+				return fmt.Errorf("socket %s is in use by another instance", address)
+			}
+
+			_ = os.Remove(address)
+		}
+	}
+
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	wh := &webhook{
+		token:    os.ExpandEnv(cfg.Token),
+		watchers: watchers,
+		ctx:      ctx,
+		lg:       log.New(os.Stderr, "webhook: ", log.LstdFlags),
+	}
+
+	srv := &http.Server{
+		Handler:           wh,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	if network == "tcp" && wh.token == "" && exposed(address) {
+		wh.lg.Printf("warning: %s is reachable from other hosts without a token\n", cfg.Address)
+	}
+
+	go func() {
+		wh.lg.Printf("listening on %s\n", cfg.Address)
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			wh.lg.Printf("error occurred during serve: %s\n", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = srv.Shutdown(sctx)
+	}()
+
+	return nil
+}
+
+func (wh *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// e.g. /watchers/api/trigger
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "watchers" || parts[2] != "trigger" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !wh.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pw, ok := wh.watchers[parts[1]]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown watcher %q", parts[1]), http.StatusNotFound)
+		return
+	}
+
+	var paths []string
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &paths); err != nil {
+			http.Error(w, fmt.Sprintf("body has to be a JSON array of paths: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ee, err := pathEvents(wd, pw.w.WatchedFiles(), paths)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wh.lg.Printf("triggering %s by %s with %d path(s)\n", pw.cfg.Name, r.RemoteAddr, len(paths))
+
+	// Watcher may be busy handling a previous update, so the request isn't held
+	go func() {
+		for _, e := range ee {
+			if !pw.trigger(wh.ctx, e) {
+				return
+			}
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (wh *webhook) authorized(r *http.Request) bool {
+	if wh.token == "" {
+		return true
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(wh.token)) == 1
+}
+
+// pathEvents converts paths into synthetic write events; A single trigger event when there's no path. Paths end up in
+// commands, so just watched files inside the working directory are accepted
+func pathEvents(wd string, watched map[string]os.FileInfo, paths []string) ([]watcher.Event, error) {
+	if len(paths) == 0 {
+		return []watcher.Event{triggerEvent("webhook")}, nil
+	}
+
+	ee := make([]watcher.Event, len(paths))
+	for i, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if rel, err := filepath.Rel(wd, abs); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("path %q is outside of the working directory", path)
+		}
+
+		fi, ok := watched[abs]
+		if !ok {
+			return nil, fmt.Errorf("path %q isn't watched", path)
+		}
+
+		ee[i] = watcher.Event{Op: watcher.Write, Path: abs, FileInfo: fi}
+	}
+
+	return ee, nil
+}
+
+// exposed reports whether a TCP address is reachable from other hosts
+func exposed(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return true
+	}
+
+	if host == "localhost" {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip == nil || !ip.IsLoopback()
+}